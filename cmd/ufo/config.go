@@ -17,10 +17,38 @@ type Config struct {
 }
 
 type Cluster struct {
-	Name       string   `mapstructure:"name"`
-	Services   []string `mapstructure:"services"`
-	Dockerfile string   `mapstructure:"dockerfile"`
-	BuildArgs  []string `mapstructure:"build-args"`
+	Name         string       `mapstructure:"name"`
+	Services     []string     `mapstructure:"services"`
+	Dockerfile   string       `mapstructure:"dockerfile"`
+	BuildArgs    []string     `mapstructure:"build-args"`
+	Containers   []*Container `mapstructure:"containers"`
+	PreDeploy    []string     `mapstructure:"pre-deploy"`
+	PostDeploy   []string     `mapstructure:"post-deploy"`
+	Webhooks     []string     `mapstructure:"webhooks"`
+	Tags         []string     `mapstructure:"tags"`
+	MovingTag    string       `mapstructure:"moving-tag"`
+	Cache        bool         `mapstructure:"cache"`
+	Builder      string       `mapstructure:"builder"`
+	BuildCommand string       `mapstructure:"build-command"`
+	Platforms    []string     `mapstructure:"platforms"`
+	Context      string       `mapstructure:"context"`
+	Target       string       `mapstructure:"target"`
+	Labels       []string     `mapstructure:"labels"`
+	Secrets      []string     `mapstructure:"secrets"`
+	SSH          []string     `mapstructure:"ssh"`
+	Scan         *Scan        `mapstructure:"scan"`
+}
+
+// Scan configures the vulnerability scan of the image before it is rolled out to a cluster
+type Scan struct {
+	Severity string   `mapstructure:"severity"`
+	Allow    []string `mapstructure:"allow"`
+	Start    bool     `mapstructure:"start"`
+}
+
+type Container struct {
+	Name string `mapstructure:"name"`
+	Repo string `mapstructure:"repo"`
 }
 
 type Task struct {
@@ -55,7 +83,6 @@ func (c *Config) getCluster(cluster string) (*Cluster, error) {
 func (c *Config) getClusters() []string {
 	var clusters []string
 	for _, cluster := range c.Clusters {
-		fmt.Printf(cluster.Name)
 		clusters = append(clusters, cluster.Name)
 	}
 	return clusters
@@ -80,6 +107,27 @@ func (c *Config) getService(services []string, service string) (*string, error)
 	return nil, ErrServiceNotFound
 }
 
+// getSelectedServices validates the selected services against the services of a cluster. All
+// services of the cluster are returned when none are selected.
+func (c *Config) getSelectedServices(cluster *Cluster, selected []string) ([]string, error) {
+	if len(selected) == 0 {
+		return cluster.Services, nil
+	}
+
+	services := []string{}
+
+	for _, service := range selected {
+		s, err := c.getService(cluster.Services, service)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s in cluster %s", err, service, cluster.Name)
+		}
+
+		services = append(services, *s)
+	}
+
+	return services, nil
+}
+
 func (c *Config) getCommand(name string) (*string, error) {
 	for _, t := range c.Tasks {
 		if t.Name == name {
@@ -98,3 +146,27 @@ func (c *Config) getBuildArgs(in string) []string {
 	}
 	return []string{}
 }
+
+// appContainer returns the name of the first configured container of a cluster, the app
+// container. The name is empty when no containers are configured, which selects the first
+// container of the task definition.
+func appContainer(cluster *Cluster) string {
+	if len(cluster.Containers) == 0 {
+		return ""
+	}
+
+	return cluster.Containers[0].Name
+}
+
+// getContainerRepos returns the configured containers of a cluster mapped to their repo
+func (c *Config) getContainerRepos(in string) map[string]string {
+	repos := map[string]string{}
+	for _, cluster := range c.Clusters {
+		if cluster.Name == in {
+			for _, container := range cluster.Containers {
+				repos[container.Name] = container.Repo
+			}
+		}
+	}
+	return repos
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetSelectedServices(t *testing.T) {
+	cluster := &Cluster{Name: "dev", Services: []string{"api", "worker", "cron"}}
+
+	cases := []struct {
+		Selected []string
+		Expected []string
+		Error    error
+	}{
+		{Selected: []string{}, Expected: []string{"api", "worker", "cron"}},
+		{Selected: []string{"worker"}, Expected: []string{"worker"}},
+		{Selected: []string{"cron", "api"}, Expected: []string{"cron", "api"}},
+		{Selected: []string{"api", "web"}, Error: ErrServiceNotFound},
+	}
+
+	for i, c := range cases {
+		services, err := (&Config{Clusters: []*Cluster{cluster}}).getSelectedServices(cluster, c.Selected)
+
+		if c.Error == nil && err != nil {
+			t.Errorf("%d, expected no error, got %s", i, err)
+		} else if c.Error != nil && (err == nil || !strings.HasPrefix(err.Error(), c.Error.Error())) {
+			t.Errorf("%d, expected error %s, got %v", i, c.Error, err)
+		}
+
+		if c.Error != nil && err != nil && !strings.HasSuffix(err.Error(), "web in cluster dev") {
+			t.Errorf("%d, expected the error to name the unknown service, got %s", i, err)
+		}
+
+		if a, e := services, c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected services %v, got %v", i, e, a)
+		}
+	}
+}
@@ -1,7 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/fuzz-productions/ufo/pkg/git"
@@ -10,54 +18,541 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var buildArgs []string
+var (
+	buildArgs                 []string
+	flagDeployDryRun          bool
+	flagDeployAutoRollback    bool
+	flagDeployForceBuild      bool
+	flagDeployRef             string
+	flagDeployAllowDirty      bool
+	flagDeployRevertOnFailure bool
+	flagDeployAllClusters     bool
+	flagDeploySequential      bool
+	flagDeployCache           bool
+	flagDeployContext         string
+	flagDeployTarget          string
+	flagDeployLabels          []string
+	flagDeploySecrets         []string
+	flagDeploySSH             []string
+)
+
+const dirtyTimeFormat = "20060102150405"
 
 var deployCmd = &cobra.Command{
 	Use:   "deploy",
 	Short: "Create a deployment",
 	Long: `A cluster must be specified via the --cluster flag.
 	The --verbose flag can be input to enable verbose output.
-	The --login flag can be input to login to AWS ECR.`,
+	The --login flag can be input to login to AWS ECR.
+	The --dry-run flag prints the task definition changes of every service without
+	building, pushing or deploying anything.
+	The --auto-rollback flag moves every service back to the task definition it ran
+	before the deploy when the deployment fails or times out.
+	The --revert-on-failure flag moves the services that were updated back when another
+	service of the cluster could not be updated.
+	The image build is skipped when the commit's image already exists in ECR, the
+	--force-build flag can be input to always build and push the image.
+	The --ref flag deploys a tag, branch or commit instead of HEAD. The image is built
+	from a clean temporary checkout of the ref.
+	Deploying a working tree with uncommitted or untracked changes is refused unless
+	the --allow-dirty flag is input, the image is then tagged <commit>-dirty-<timestamp>.
+	Several clusters can be input as --cluster dev,qa, or every configured cluster with the
+	--all-clusters flag. The image is built once and rolled out to all clusters at once, the
+	--sequential flag deploys one cluster after another and stops at the first failing cluster.
+	One or more --service flags deploy only those services of the cluster.
+	The --context, --target, --label, --secret and --ssh flags are passed to the build and
+	add to the build settings of the cluster.
+	Build args can reference environment variables and files as ${ENV_VAR} and ${file:path},
+	the resolved values are masked in the output.
+	The --cache flag pulls the image the services run and the latest image of the branch and
+	uses them as layer cache of the build.
+	A cluster with a scan in its config waits for the ECR vulnerability scan of the image and
+	is not deployed when it found vulnerabilities at or above the cluster's severity threshold.
+	The cluster is locked for the duration of the deploy, see ufo lock.
+	The --output json flag prints every step of the deploy as a JSON event on its own line.
+	An interrupt stops the deploy and prints the state every service was left in.`,
 	RunE: runDeploy,
 }
 
 func runDeploy(cmd *cobra.Command, args []string) error {
-	return deploy(flagCluster, flagTimeout)
+	ctx, stop := interruptContext()
+	defer stop()
+
+	clusterNames, err := deployClusterNames()
+	if err != nil {
+		return reportError(err)
+	}
+
+	return reportError(deploy(ctx, clusterNames, flagTimeout))
+}
+
+// deployClusterNames returns the clusters to deploy to, every configured cluster with
+// --all-clusters or the comma separated clusters of --cluster
+func deployClusterNames() ([]string, error) {
+	if flagDeployAllClusters {
+		if flagCluster != "" {
+			return nil, ErrClusterFlags
+		}
+
+		return uniqueNames(cfg.getClusters()), nil
+	}
+
+	names := uniqueNames(strings.Split(flagCluster, ","))
+
+	if len(names) == 0 {
+		return nil, ErrClusterNotFound
+	}
+
+	return names, nil
 }
 
-func deploy(clusterName string, timeout int) error {
-	ufo := UFO.New(awsConfig)
+// uniqueNames returns the names that are not empty without surrounding spaces and duplicates
+func uniqueNames(in []string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+
+	for _, name := range in {
+		if name = strings.TrimSpace(name); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// clusterDeploy is the deployment of a single cluster in a deploy to several clusters
+type clusterDeploy struct {
+	cluster      *Cluster
+	services     []string
+	deployment   *UFO.Deployment
+	movingTag    string
+	notification *notification
+	blocked      error
+}
+
+// deploy builds and pushes the image of a commit once and rolls it out to every cluster
+func deploy(ctx context.Context, clusterNames []string, timeout int) error {
+	ufo := newUFO()
 
 	commit, err := git.GetCommit()
+	if flagDeployRef != "" {
+		commit, err = git.ResolveRef(flagDeployRef)
+	}
 	if err != nil {
 		return err
 	}
 
-	cluster, err := cfg.getCluster(clusterName)
+	// A ref is built from a clean worktree, otherwise make sure the image matches its commit
+	dirty := false
+	if flagDeployRef == "" {
+		dirty, err = checkDirty()
+		if err != nil {
+			return err
+		}
+	}
+
+	built := time.Now().UTC()
+
+	// Build args can reference environment variables and files, e.g. the tokens of a CI job
+	flagBuildArgs, err := interpolate(buildArgs)
 	if err != nil {
 		return err
 	}
 
-	configBuildArgs := cfg.getBuildArgs(clusterName)
+	deploys := []*clusterDeploy{}
 
-	deployment := &UFO.Deployment{}
-	deployment.SetCommitHash(commit)
-	deployment.SetRepo(cfg.Repo)
-	deployment.SetDockerfile(cluster.Dockerfile)
-	deployment.SetBuildArgs(buildArgs)
-	deployment.SetConfigBuildArgs(configBuildArgs)
+	for _, clusterName := range clusterNames {
+		cluster, err := cfg.getCluster(clusterName)
+		if err != nil {
+			return err
+		}
 
-	// Build Docker image and push to repo
-	err = ufo.LoginBuildPushImage(deployment.BuildDetail)
+		services, err := cfg.getSelectedServices(cluster, flagServices)
+		if err != nil {
+			return err
+		}
+
+		if err := checkScanSettings(cluster); err != nil {
+			return err
+		}
+
+		tag, tags, err := imageTags(cluster, commit, flagDeployRef, dirty, built)
+		if err != nil {
+			return err
+		}
+
+		configBuildArgs, err := interpolate(cfg.getBuildArgs(clusterName))
+		if err != nil {
+			return err
+		}
+
+		deployment := &UFO.Deployment{}
+		deployment.SetOperation(newOperation(UFO.OperationDeploy))
+		deployment.SetCommitHash(tag)
+		deployment.SetTags(tags)
+		deployment.SetRepo(cfg.Repo)
+		deployment.SetDockerfile(cluster.Dockerfile)
+		deployment.SetBuilder(cluster.Builder)
+		deployment.SetBuildCommand(cluster.BuildCommand)
+		deployment.SetPlatforms(cluster.Platforms)
+		deployment.SetContext(firstNonEmpty(flagDeployContext, cluster.Context))
+		deployment.SetTarget(firstNonEmpty(flagDeployTarget, cluster.Target))
+		deployment.SetLabels(append(append([]string{}, cluster.Labels...), flagDeployLabels...))
+		deployment.SetSecrets(append(append([]string{}, cluster.Secrets...), flagDeploySecrets...))
+		deployment.SetSSH(append(append([]string{}, cluster.SSH...), flagDeploySSH...))
+		deployment.SetBuildArgs(flagBuildArgs)
+		deployment.SetConfigBuildArgs(configBuildArgs)
+		deployment.SetContainerRepos(cfg.getContainerRepos(clusterName))
+
+		err = resolveDeployDetails(ctx, ufo, cluster, services, deployment)
+		if err != nil {
+			return err
+		}
+
+		deploys = append(deploys, &clusterDeploy{cluster: cluster, services: services, deployment: deployment, movingTag: movingTag(cluster, dirty)})
+	}
+
+	// Every cluster gets the same image, so they have to build it the same way
+	if err := checkBuildSettings(deploys); err != nil {
+		return err
+	}
+
+	if _, err := ufo.Builder(deploys[0].deployment.BuildDetail); err != nil {
+		return err
+	}
+
+	if flagDeployDryRun {
+		for _, d := range deploys {
+			plans, err := ufo.PlanAll(d.deployment)
+			if err != nil {
+				return err
+			}
+
+			if len(deploys) > 1 && flagOutput == outputText {
+				fmt.Printf("Cluster %s\n\n", d.cluster.Name)
+			}
+
+			printPlans(plans)
+		}
+
+		return nil
+	}
+
+	// Lock the clusters before building so a concurrent deploy can't overwrite this one. A
+	// sequential rollout keeps the last cluster locked while the ones before it roll out.
+	rollouts := 1
+	if flagDeploySequential {
+		rollouts = len(deploys)
+	}
+
+	for _, d := range deploys {
+		release, err := lockCluster(ctx, ufo, d.cluster, commit, timeout, rollouts)
+		if err != nil {
+			return err
+		}
+
+		defer release()
+	}
+
+	for _, d := range deploys {
+		d.notification = startNotification(d.cluster.Name, UFO.OperationDeploy, d.services, commit)
+	}
+
+	// The image is built once with the build settings of the first cluster and the tags of
+	// every cluster. Moving tags are only moved once their cluster runs the image.
+	deploys[0].deployment.SetTags(clusterTags(deploys))
+
+	if flagDeployCache || deploys[0].cluster.Cache {
+		deploys[0].deployment.SetCacheFrom(cacheImages(deploys))
+	}
+
+	err = buildImageOnce(ctx, ufo, deploys[0].deployment, commit)
+	if err == nil {
+		// Every cluster checks the findings of the image against its own severity threshold
+		err = scanImage(ctx, ufo, deploys, timeout)
+	}
 	if err != nil {
+		err = interrupted(ctx, ufo, deploys[0].deployment, err)
+
+		for _, d := range deploys {
+			d.notification.finish(err)
+		}
+
+		return err
+	}
+
+	if len(deploys) == 1 {
+		d := deploys[0]
+
+		if flagOutput == outputText {
+			term.Clear()
+		}
+
+		err = rolloutCluster(ctx, ufo, d, timeout)
+
+		return d.notification.finish(interrupted(ctx, ufo, d.deployment, err))
+	}
+
+	if flagDeploySequential {
+		return rolloutSequential(ctx, ufo, deploys, timeout)
+	}
+
+	return rolloutConcurrent(ctx, ufo, deploys, timeout)
+}
+
+// checkBuildSettings returns an error unless every cluster builds its image with the same
+// settings and uses the same immutable tag
+func checkBuildSettings(deploys []*clusterDeploy) error {
+	first := buildSettings(deploys[0].deployment)
+
+	for _, d := range deploys[1:] {
+		if !reflect.DeepEqual(buildSettings(d.deployment), first) {
+			return ErrClusterBuildMismatch
+		}
+	}
+
+	return nil
+}
+
+// buildSettings returns the build detail of a deployment without the additional tags and
+// container repos, which may differ between clusters that share an image
+func buildSettings(deployment *UFO.Deployment) UFO.BuildDetail {
+	settings := deployment.BuildDetail
+	settings.Tags = nil
+	settings.ContainerRepos = nil
+
+	return settings
+}
+
+// clusterTags returns the additional image tags of every cluster without duplicates
+func clusterTags(deploys []*clusterDeploy) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+
+	for _, d := range deploys {
+		for _, tag := range d.deployment.BuildDetail.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
+
+// firstNonEmpty returns the first value that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// cacheImages returns the images the services of every cluster run and the latest image of
+// the branch, which is only pushed with the branch tag strategy
+func cacheImages(deploys []*clusterDeploy) []string {
+	seen := map[string]bool{}
+	images := []string{}
+
+	for _, d := range deploys {
+		for _, image := range d.deployment.DeployedImages() {
+			if !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+
+	branch := flagDeployRef
+	if branch == "" {
+		branch, _ = git.GetBranch()
+	}
+
+	if branch != "" && branch != "HEAD" {
+		image := fmt.Sprintf("%s:%s", cfg.Repo, sanitizeTag(branch))
+
+		if !seen[image] {
+			images = append(images, image)
+		}
+	}
+
+	return images
+}
+
+// buildImageOnce builds and pushes the deployment's image of a commit unless it already
+// exists, in which case the existing image gets the additional tags
+func buildImageOnce(ctx context.Context, ufo *UFO.UFO, deployment *UFO.Deployment, commit string) error {
+	tag := deployment.BuildDetail.CommitHash
+
+	// Skip the build when an image for this commit was already pushed, e.g. by a deploy
+	// to another cluster
+	if !flagDeployForceBuild {
+		exists, err := ufo.ImageExistsWithContext(ctx, cfg.Repo, tag)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			logf("Image %s:%s already exists, skipping build\n", cfg.Repo, tag)
+			return ufo.TagImageWithContext(ctx, cfg.Repo, tag, deployment.BuildDetail.Tags)
+		}
+	}
+
+	// Build Docker image and push to repo
+	return buildImage(ctx, ufo, deployment, commit, flagDeployRef)
+}
+
+// rolloutCluster rolls the image out to a cluster unless the image scan blocked it, then moves
+// the moving tag of the cluster to the image
+func rolloutCluster(ctx context.Context, ufo *UFO.UFO, d *clusterDeploy, timeout int) error {
+	if d.blocked != nil {
+		return d.blocked
+	}
+
+	if err := rollout(ctx, ufo, d.cluster, d.deployment, timeout); err != nil {
 		return err
 	}
 
-	for _, service := range cluster.Services {
+	if d.movingTag == "" {
+		return nil
+	}
+
+	// The cluster already runs the image, so it is not failed when the tag can't be moved
+	tags := []string{d.movingTag}
+	if err := ufo.TagImageWithContext(ctx, cfg.Repo, d.deployment.BuildDetail.CommitHash, tags); err != nil {
+		logf("Warning: could not move tag %s of cluster %s: %s\n", d.movingTag, d.cluster.Name, err)
+	}
+
+	return nil
+}
+
+// rolloutSequential rolls the image out to one cluster after another and stops at the first
+// cluster that fails. The clusters after it are not deployed.
+func rolloutSequential(ctx context.Context, ufo *UFO.UFO, deploys []*clusterDeploy, timeout int) error {
+	for i, d := range deploys {
+		logf("Deploying to cluster %s\n", d.cluster.Name)
+
+		err := rolloutCluster(ctx, ufo, d, timeout)
+		err = d.notification.finish(interrupted(ctx, ufo, d.deployment, err))
+
+		if err != nil {
+			for _, skipped := range deploys[i+1:] {
+				skipped.notification.finish(ErrClusterSkipped)
+			}
+
+			return fmt.Errorf("cluster %s: %s", d.cluster.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// rolloutConcurrent rolls the image out to every cluster at once and prints the result of
+// each cluster when one of them failed
+func rolloutConcurrent(ctx context.Context, ufo *UFO.UFO, deploys []*clusterDeploy, timeout int) error {
+	errs := make([]error, len(deploys))
+
+	var wg sync.WaitGroup
+
+	for i, d := range deploys {
+		wg.Add(1)
+
+		go func(i int, d *clusterDeploy) {
+			defer wg.Done()
+
+			err := rolloutCluster(ctx, ufo, d, timeout)
+			errs[i] = d.notification.finish(interrupted(ctx, ufo, d.deployment, err))
+		}(i, d)
+	}
+
+	wg.Wait()
+
+	failed := false
+	for _, err := range errs {
+		failed = failed || err != nil
+	}
+
+	if !failed {
+		return nil
+	}
+
+	printClusterResults(deploys, errs)
+
+	return ErrClusterDeployFailed
+}
+
+// printClusterResults prints the result of the rollout to each cluster
+func printClusterResults(deploys []*clusterDeploy, errs []error) {
+	w := tabwriter.NewWriter(term.Output, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "CLUSTER\tRESULT\tERROR\t")
+
+	for i, d := range deploys {
+		result, errMsg := UFO.ResultSucceeded, "-"
+		if errs[i] != nil {
+			result, errMsg = UFO.ResultFailed, errs[i].Error()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", d.cluster.Name, result, errMsg)
+	}
+
+	w.Flush()
+}
+
+// checkDirty refuses to deploy uncommitted changes unless --allow-dirty is set, in which case
+// it returns true so the image is tagged as dirty and can't be mistaken for the clean commit
+func checkDirty() (bool, error) {
+	dirty, err := git.IsDirty()
+	if err != nil {
+		return false, err
+	}
+
+	if dirty && !flagDeployAllowDirty {
+		return false, ErrDirtyWorkingTree
+	}
+
+	return dirty, nil
+}
+
+// buildImage builds and pushes the deployment's image. When a ref is given the image is
+// built from a clean temporary worktree of the commit.
+func buildImage(ctx context.Context, ufo *UFO.UFO, deployment *UFO.Deployment, commit string, ref string) error {
+	// An image that is built elsewhere needs no checkout
+	if ref != "" && deployment.BuildDetail.Builder != UFO.BuilderNone {
+		worktree, err := git.AddWorktree(commit)
+		if err != nil {
+			return err
+		}
+
+		defer git.RemoveWorktree(worktree)
+
+		// Build from the same directory of the worktree ufo was started in
+		prefix, err := git.GetPrefix()
+		if err != nil {
+			return err
+		}
+
+		deployment.SetDir(filepath.Join(worktree, prefix))
+
+		logf("Building %s (%s) in %s\n", ref, commit, worktree)
+	}
+
+	return ufo.LoginBuildPushImageWithContext(ctx, deployment.BuildDetail)
+}
+
+// resolveDeployDetails adds a deploy detail with the current ECS cluster, service and task
+// definition to the deployment for every given service of a cluster
+func resolveDeployDetails(ctx context.Context, ufo *UFO.UFO, cluster *Cluster, services []string, deployment *UFO.Deployment) error {
+	for _, service := range services {
 		detail := ufo.NewDeployDetail()
 
 		// Get the ECS Cluster
-		ecsCluster, err := ufo.GetCluster(cluster.Name)
+		ecsCluster, err := ufo.GetClusterWithContext(ctx, cluster.Name)
 		if err != nil {
 			return err
 		}
@@ -66,7 +561,7 @@ func deploy(clusterName string, timeout int) error {
 		detail.SetCluster(ecsCluster)
 
 		// Get the ECS Service
-		ecsService, err := ufo.GetService(detail.Cluster, service)
+		ecsService, err := ufo.GetServiceWithContext(ctx, detail.Cluster, service)
 		if err != nil {
 			return err
 		}
@@ -75,7 +570,7 @@ func deploy(clusterName string, timeout int) error {
 		detail.SetService(ecsService)
 
 		// Get the Service's TaskDefinition
-		ecsTaskDef, err := ufo.GetTaskDefinition(detail.Cluster, detail.Service)
+		ecsTaskDef, err := ufo.GetTaskDefinitionWithContext(ctx, detail.Cluster, detail.Service)
 		if err != nil {
 			return err
 		}
@@ -86,22 +581,74 @@ func deploy(clusterName string, timeout int) error {
 		deployment.DeployDetails = append(deployment.DeployDetails, detail)
 	}
 
-	term.Clear()
+	return nil
+}
 
-	errCh := ufo.DeployAll(deployment)
+// rollout registers new task definitions for a resolved deployment, runs the deploy tasks,
+// updates the services and waits for them to run
+func rollout(ctx context.Context, ufo *UFO.UFO, cluster *Cluster, deployment *UFO.Deployment, timeout int) error {
+	// No service has been touched yet when a task definition can't be registered
+	results := ufo.RegisterAllWithContext(ctx, deployment)
+	if err := results.Err(); err != nil {
+		printResults(results)
+		return err
+	}
 
-	for err := range errCh {
+	// Run the pre-deploy tasks with the new task definition before any service is updated
+	err := runHooks(ctx, ufo, cluster, deployment, "pre-deploy", cluster.PreDeploy, timeout)
+	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Waiting for deployment(s) to services [ %s]\n", deployment.Services())
-	doneCh := ufo.AwaitServicesRunning(deployment)
+	results = ufo.UpdateAllWithContext(ctx, deployment)
+	if err := results.Err(); err != nil {
+		printResults(results)
+		return revertOnFailure(ufo, results, err)
+	}
+
+	logf("Waiting for deployment(s) to services [ %s]\n", deployment.Services())
+
+	err = awaitServices(ctx, ufo, deployment, timeout)
+	if err == ErrDeployFailed || err == ErrDeployTimeout {
+		return autoRollback(ufo, deployment, err)
+	} else if err != nil {
+		return err
+	}
+
+	return runHooks(ctx, ufo, cluster, deployment, "post-deploy", cluster.PostDeploy, timeout)
+}
+
+// awaitServices waits for every service of a deployment to run. It returns ErrDeployFailed when
+// ECS reports a rollout as failed, ErrDeployTimeout when the services don't run within timeout
+// minutes, or the error of ctx. The services are no longer polled once it returns, so the
+// deployment can be reverted safely.
+func awaitServices(ctx context.Context, ufo *UFO.UFO, deployment *UFO.Deployment, timeout int) error {
+	awaitCtx, cancel := context.WithCancel(ctx)
+	doneCh := ufo.AwaitServicesRunningWithContext(awaitCtx, deployment)
+
+	defer func() {
+		cancel()
+
+		for range doneCh {
+		}
+	}()
+
+	deadline := time.NewTimer(time.Minute * time.Duration(timeout))
+	defer deadline.Stop()
 
 	for i := 0; i < len(deployment.DeployDetails); i++ {
 		select {
-		case detail := <-doneCh:
-			fmt.Printf("Service %s (%s) is now running \n", *detail.Service.ServiceName, detail.TaskDefinitionFamily())
-		case <-time.After(time.Minute * time.Duration(timeout)):
+		case detail, ok := <-doneCh:
+			if !ok {
+				return ctx.Err()
+			}
+
+			if detail.Failed {
+				return ErrDeployFailed
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
 			return ErrDeployTimeout
 		}
 	}
@@ -109,7 +656,151 @@ func deploy(clusterName string, timeout int) error {
 	return nil
 }
 
+// runHooks runs the configured task aliases one after another with the new task definition of
+// the first service in the deployment. The tasks run in the app container of the cluster. It
+// stops at the first task that exits non-zero or doesn't stop within timeout minutes.
+func runHooks(ctx context.Context, ufo *UFO.UFO, cluster *Cluster, deployment *UFO.Deployment, stage string, aliases []string, timeout int) error {
+	if len(aliases) == 0 || len(deployment.DeployDetails) == 0 {
+		return nil
+	}
+
+	detail := deployment.DeployDetails[0]
+
+	for _, alias := range aliases {
+		command, err := cfg.getCommand(alias)
+		if err != nil {
+			return err
+		}
+
+		logf("Running %s task %s (%s) with %s\n", stage, alias, *command, detail.TaskDefinitionFamily())
+
+		if err := runHook(ctx, ufo, detail, appContainer(cluster), *command, timeout); err != nil {
+			return err
+		}
+
+		logf("Task %s finished\n", alias)
+	}
+
+	return nil
+}
+
+// runHook runs a deploy task and waits at most timeout minutes for it to stop
+func runHook(ctx context.Context, ufo *UFO.UFO, detail *UFO.DeployDetail, container string, command string, timeout int) error {
+	hookCtx, cancel := context.WithTimeout(ctx, time.Minute*time.Duration(timeout))
+	defer cancel()
+
+	err := ufo.RunHookWithContext(hookCtx, detail, container, command)
+	if err != nil && ctx.Err() == nil && hookCtx.Err() == context.DeadlineExceeded {
+		return ErrHookTimeout
+	}
+
+	return err
+}
+
+// autoRollback moves every service of a failed deployment back to the task definition it ran
+// before the deploy when --auto-rollback is set. It returns the error that caused the rollback
+// unless a service could not be rolled back.
+func autoRollback(ufo *UFO.UFO, deployment *UFO.Deployment, cause error) error {
+	if !flagDeployAutoRollback {
+		return cause
+	}
+
+	logf("%s, rolling back service(s) [ %s]\n", cause, deployment.Services())
+
+	results := ufo.RevertAll(deployment)
+	if results.Err() != nil {
+		printResults(results)
+		return ErrRollbackIncomplete
+	}
+
+	return cause
+}
+
+// revertOnFailure moves the services that were updated back to the task definition they ran
+// before the deploy when --revert-on-failure is set and another service could not be updated.
+// It returns the error that caused the revert unless a service could not be reverted.
+func revertOnFailure(ufo *UFO.UFO, results UFO.ServiceResults, cause error) error {
+	updated := results.Succeeded()
+
+	if !flagDeployRevertOnFailure || len(updated) == 0 {
+		return cause
+	}
+
+	logf("Not every service could be updated, reverting the %d service(s) that were\n", len(updated))
+
+	reverted := ufo.Revert(updated)
+	if reverted.Err() != nil {
+		printResults(reverted)
+		return ErrRollbackIncomplete
+	}
+
+	return cause
+}
+
+// printPlans prints the changes a deployment would make to the task definition of each service
+func printPlans(plans []*UFO.Plan) {
+	if flagOutput == outputJSON {
+		printPlansJSON(plans)
+		return
+	}
+
+	for _, plan := range plans {
+		fmt.Printf("Service %s (%s)\n", *plan.Detail.Service.ServiceName, plan.Detail.TaskDefinitionFamily())
+
+		if len(plan.Diff) == 0 {
+			fmt.Printf("  no changes\n\n")
+			continue
+		}
+
+		longestField := 0
+		for _, diff := range plan.Diff {
+			if len(diff.Field) > longestField {
+				longestField = len(diff.Field)
+			}
+		}
+
+		for _, diff := range plan.Diff {
+			fmt.Printf("  %s%s  %q -> %q\n", diff.Field, strings.Repeat(" ", longestField-len(diff.Field)), diff.Old, diff.New)
+		}
+
+		fmt.Printf("\n")
+	}
+}
+
+// printPlansJSON prints the plan of each service as a JSON object on its own line
+func printPlansJSON(plans []*UFO.Plan) {
+	enc := json.NewEncoder(os.Stdout)
+
+	for _, plan := range plans {
+		enc.Encode(struct {
+			Cluster        string           `json:"cluster"`
+			Service        string           `json:"service"`
+			TaskDefinition string           `json:"taskDefinition"`
+			Diff           []*UFO.FieldDiff `json:"diff"`
+		}{
+			Cluster:        *plan.Detail.Cluster.ClusterName,
+			Service:        *plan.Detail.Service.ServiceName,
+			TaskDefinition: plan.Detail.TaskDefinitionFamily(),
+			Diff:           plan.Diff,
+		})
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(deployCmd)
 	deployCmd.Flags().StringSliceVarP(&buildArgs, "build-arg", "b", []string{}, "Set build-time variables")
+	deployCmd.Flags().BoolVar(&flagDeployDryRun, "dry-run", false, "Print the task definition changes without deploying")
+	deployCmd.Flags().BoolVar(&flagDeployAutoRollback, "auto-rollback", false, "Roll back all services when the deployment fails or times out")
+	deployCmd.Flags().BoolVar(&flagDeployForceBuild, "force-build", false, "Build and push the image even if it already exists in ECR")
+	deployCmd.Flags().StringVar(&flagDeployRef, "ref", "", "Deploy a git tag, branch or commit instead of HEAD")
+	deployCmd.Flags().BoolVar(&flagDeployRevertOnFailure, "revert-on-failure", false, "Revert the services that were updated when another service could not be updated")
+	deployCmd.Flags().BoolVar(&flagDeployAllClusters, "all-clusters", false, "Deploy to every cluster in the config")
+	deployCmd.Flags().BoolVar(&flagDeploySequential, "sequential", false, "Deploy to one cluster after another and stop at the first failing cluster")
+	deployCmd.Flags().BoolVar(&flagDeployCache, "cache", false, "Use the deployed image and the branch image as build cache")
+	deployCmd.Flags().StringVar(&flagDeployContext, "context", "", "Build context directory, overrides the context of the cluster")
+	deployCmd.Flags().StringVar(&flagDeployTarget, "target", "", "Stage of the dockerfile to build, overrides the target of the cluster")
+	deployCmd.Flags().StringArrayVar(&flagDeployLabels, "label", []string{}, "Set a key=value label on the image")
+	deployCmd.Flags().StringArrayVar(&flagDeploySecrets, "secret", []string{}, "Expose a secret to the build e.g. id=npm,src=.npmrc")
+	deployCmd.Flags().StringArrayVar(&flagDeploySSH, "ssh", []string{}, "Forward an ssh agent socket or key to the build e.g. default")
+	deployCmd.Flags().BoolVar(&flagDeployAllowDirty, "allow-dirty", false, "Deploy uncommitted changes with a -dirty image tag")
 }
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+)
+
+func TestDeployClusterNames(t *testing.T) {
+	defer func(c *Config, cluster string, all bool) {
+		cfg, flagCluster, flagDeployAllClusters = c, cluster, all
+	}(cfg, flagCluster, flagDeployAllClusters)
+
+	cfg = &Config{Clusters: []*Cluster{{Name: "dev"}, {Name: "staging"}, {Name: "dev"}}}
+
+	cases := []struct {
+		Cluster     string
+		AllClusters bool
+		Expected    []string
+		Error       error
+	}{
+		{Cluster: "dev", Expected: []string{"dev"}},
+		{Cluster: "dev, staging", Expected: []string{"dev", "staging"}},
+		{Cluster: "dev,staging,dev", Expected: []string{"dev", "staging"}},
+		{Cluster: " , ", Error: ErrClusterNotFound},
+		{Cluster: "", Error: ErrClusterNotFound},
+		{AllClusters: true, Expected: []string{"dev", "staging"}},
+		{Cluster: "dev", AllClusters: true, Error: ErrClusterFlags},
+	}
+
+	for i, c := range cases {
+		flagCluster, flagDeployAllClusters = c.Cluster, c.AllClusters
+
+		names, err := deployClusterNames()
+
+		if a, e := err, c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, a)
+		}
+
+		if a, e := names, c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected clusters %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestCheckBuildSettings(t *testing.T) {
+	clusterDeployment := func(build UFO.BuildDetail) *clusterDeploy {
+		return &clusterDeploy{deployment: &UFO.Deployment{BuildDetail: build}}
+	}
+
+	cases := []struct {
+		Builds []UFO.BuildDetail
+		Error  error
+	}{
+		{
+			Builds: []UFO.BuildDetail{{Repo: "app", Dockerfile: "Dockerfile"}},
+		},
+		{
+			Builds: []UFO.BuildDetail{
+				{Repo: "app", Dockerfile: "Dockerfile", Tags: []string{"dev-latest"}, ContainerRepos: map[string]string{"app": ""}},
+				{Repo: "app", Dockerfile: "Dockerfile", Tags: []string{"prod-latest"}},
+			},
+		},
+		{
+			Builds: []UFO.BuildDetail{
+				{Repo: "app", Dockerfile: "Dockerfile"},
+				{Repo: "app", Dockerfile: "Dockerfile.prod"},
+			},
+			Error: ErrClusterBuildMismatch,
+		},
+		{
+			Builds: []UFO.BuildDetail{
+				{Repo: "app", Dockerfile: "Dockerfile", Platforms: []string{"linux/amd64"}},
+				{Repo: "app", Dockerfile: "Dockerfile", Platforms: []string{"linux/arm64"}},
+			},
+			Error: ErrClusterBuildMismatch,
+		},
+	}
+
+	for i, c := range cases {
+		deploys := []*clusterDeploy{}
+		for _, build := range c.Builds {
+			deploys = append(deploys, clusterDeployment(build))
+		}
+
+		if a, e := checkBuildSettings(deploys), c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, a)
+		}
+	}
+}
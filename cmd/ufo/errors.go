@@ -8,14 +8,35 @@ import (
 
 // Config Errors
 var (
-	ErrClusterNotFound = errors.New("Selected cluster could not be found. Please check your config")
-	ErrServiceNotFound = errors.New("Selected service could not be found. Please check your config")
-	ErrCommandNotFound = errors.New("Selected command could not be found. Please check your config")
+	ErrClusterNotFound     = errors.New("Selected cluster could not be found. Please check your config")
+	ErrServiceNotFound     = errors.New("Selected service could not be found. Please check your config")
+	ErrCommandNotFound     = errors.New("Selected command could not be found. Please check your config")
+	ErrInvalidOutput       = errors.New("The output format must be text or json")
+	ErrInvalidTagStrategy  = errors.New("Unknown tag strategy, use full-sha, short-sha, branch, semver or timestamp")
+	ErrReferenceUndefined  = errors.New("A build arg references an environment variable that is not set")
+	ErrReferenceFile       = errors.New("A build arg references a file that could not be read")
+	ErrNoImmutableTag      = errors.New("The tags of a cluster need a full-sha, short-sha, semver or timestamp tag for the task definition")
+	ErrInvalidHistoryLimit = errors.New("The number of revisions to show must be at least 1")
+	ErrSingleService       = errors.New("This command works on a single service, pass --service once")
 )
 
 // Deploy Errors
 var (
-	ErrDeployTimeout = errors.New("Timed out waiting for task to start")
+	ErrDeployTimeout        = errors.New("Timed out waiting for task to start")
+	ErrDeployFailed         = errors.New("ECS reported the deployment as failed")
+	ErrRollbackIncomplete   = errors.New("Deployment failed and not every service could be rolled back")
+	ErrImageNotFound        = errors.New("The image could not be found in the configured repo")
+	ErrPromoteMixedImages   = errors.New("The services of the cluster to promote from run different images")
+	ErrDirtyWorkingTree     = errors.New("The working tree has uncommitted or untracked changes. Commit them or use --allow-dirty")
+	ErrLockHeldByOther      = errors.New("The cluster lock is held by someone else. Use --force to release it anyway")
+	ErrInterrupted          = errors.New("Interrupted before the deployment finished")
+	ErrTaskInterrupted      = errors.New("Interrupted while waiting for the task, it keeps running on the cluster")
+	ErrHookTimeout          = errors.New("Timed out waiting for a deploy task to stop, it keeps running on the cluster")
+	ErrClusterFlags         = errors.New("Use either --cluster or --all-clusters")
+	ErrClusterBuildMismatch = errors.New("The clusters build their image with different build settings or tags, deploy them separately")
+	ErrClusterDeployFailed  = errors.New("The deployment failed on at least one cluster")
+	ErrClusterSkipped       = errors.New("Not deployed because an earlier cluster failed")
+	ErrScanFindings         = errors.New("The image scan found vulnerabilities at or above the severity threshold of the cluster")
 )
 
 // Init errors
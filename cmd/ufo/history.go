@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fuzz-productions/ufo/pkg/git"
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+	"github.com/spf13/cobra"
+)
+
+var flagHistoryLimit int
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the deploy history of a service",
+	Long: `A cluster and service must be specified via the --cluster and --service flags.
+	Lists the revisions of the service's task definition family, newest first, with their
+	image tag, registration time, who registered them and whether they were registered by
+	a deploy, an environment change or a rollback.`,
+	RunE: runHistory,
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	if flagHistoryLimit < 1 {
+		return ErrInvalidHistoryLimit
+	}
+
+	if err := checkSingleService(flagServices); err != nil {
+		return err
+	}
+
+	cfgCluster, err := cfg.getCluster(flagCluster)
+	if err != nil {
+		return err
+	}
+
+	cfgService, err := cfg.getService(cfgCluster.Services, flagService)
+	if err != nil {
+		return err
+	}
+
+	ufo := UFO.New(awsConfig)
+
+	c, err := ufo.GetCluster(cfgCluster.Name)
+	if err != nil {
+		return err
+	}
+
+	s, err := ufo.GetService(c, *cfgService)
+	if err != nil {
+		return err
+	}
+
+	t, err := ufo.GetTaskDefinition(c, s)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := ufo.TaskDefinitionHistory(*t.Family, flagHistoryLimit)
+	if err != nil {
+		return err
+	}
+
+	container := ""
+	if len(cfgCluster.Containers) > 0 {
+		container = cfgCluster.Containers[0].Name
+	}
+
+	printHistoryTable(revisions, *s.TaskDefinition, container)
+
+	return nil
+}
+
+func printHistoryTable(revisions []*UFO.Revision, current string, container string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "REVISION\tIMAGE TAG\tREGISTERED\tDEPLOYER\tOPERATION\t")
+
+	for _, revision := range revisions {
+		t := revision.TaskDefinition
+		number := strconv.FormatInt(aws.Int64Value(t.Revision), 10)
+
+		if aws.StringValue(t.TaskDefinitionArn) == current {
+			number += " *"
+		}
+
+		registered := "-"
+		if t.RegisteredAt != nil {
+			registered = t.RegisteredAt.Local().Format(timeFormat)
+		}
+
+		deployer, operation := aws.StringValue(t.RegisteredBy), "-"
+		if op := revision.Operation; op != nil {
+			deployer, operation = op.Deployer, op.Type
+		}
+
+		if rollback := revision.Rollback; rollback != nil {
+			operation = fmt.Sprintf("%s, rollback from %s", operation, rollback.Source)
+
+			if rollback.Deployer != "" {
+				operation += " by " + rollback.Deployer
+			}
+		}
+
+		if deployer == "" {
+			deployer = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", number, revision.ImageTag(container), registered, deployer, operation)
+	}
+
+	w.Flush()
+}
+
+// newOperation returns an operation of the given type performed by the current user
+func newOperation(opType string) *UFO.Operation {
+	deployer, err := git.GetUser()
+
+	if err != nil || deployer == "" {
+		deployer = os.Getenv("USER")
+	}
+
+	return &UFO.Operation{
+		Type:     opType,
+		Deployer: deployer,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().IntVarP(&flagHistoryLimit, "limit", "n", 10, "Number of revisions to show")
+}
@@ -76,7 +76,10 @@ func interactiveDeploy(cmd *cobra.Command, args []string) error {
 	}
 
 	if toBool(confirmAnswer.Confirm) {
-		return deploy(clusterAnswer.Cluster, 5)
+		ctx, stop := interruptContext()
+		defer stop()
+
+		return deploy(ctx, []string{clusterAnswer.Cluster}, 5)
 	}
 
 	return nil
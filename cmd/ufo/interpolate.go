@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+)
+
+// filePrefix marks a reference to the contents of a file
+const filePrefix = "file:"
+
+// references matches ${ENV_VAR} and ${file:path} references
+var references = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// interpolate resolves the ${ENV_VAR} and ${file:path} references of every value. Resolved
+// values are masked in the output, since they are usually tokens that should not be
+// committed to the config.
+func interpolate(values []string) ([]string, error) {
+	resolved := make([]string, len(values))
+
+	for i, value := range values {
+		var err error
+
+		resolved[i] = references.ReplaceAllStringFunc(value, func(ref string) string {
+			if err != nil {
+				return ref
+			}
+
+			var v string
+			v, err = resolveReference(references.FindStringSubmatch(ref)[1])
+
+			term.AddMask(v)
+
+			return v
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
+
+// resolveReference returns the value of an environment variable, or the contents of a file
+// without its trailing newline. Relative file paths are relative to the current directory.
+func resolveReference(name string) (string, error) {
+	if strings.HasPrefix(name, filePrefix) {
+		b, err := ioutil.ReadFile(strings.TrimPrefix(name, filePrefix))
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", ErrReferenceFile, err)
+		}
+
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%s: %s", ErrReferenceUndefined, name)
+	}
+
+	return value, nil
+}
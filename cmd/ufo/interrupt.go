@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+)
+
+// interruptContext returns a context that is canceled on SIGINT or SIGTERM so a deployment
+// can stop cleanly. A second signal exits immediately. The returned function stops listening
+// for signals.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	stopCh := make(chan struct{})
+
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			logf("\nReceived %s, stopping. Interrupt again to exit immediately\n", sig)
+			cancel()
+		case <-stopCh:
+			return
+		}
+
+		select {
+		case <-sigCh:
+			os.Exit(1)
+		case <-stopCh:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigCh)
+		close(stopCh)
+		cancel()
+	}
+}
+
+// interrupted prints the state the services of a deployment were left in and returns
+// ErrInterrupted when ctx was canceled, otherwise it returns err
+func interrupted(ctx context.Context, ufo *UFO.UFO, deployment *UFO.Deployment, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+
+	printServiceStates(ufo, deployment)
+
+	return ErrInterrupted
+}
+
+// printServiceStates prints the state of every service of a deployment, it goes to stderr
+// in json mode
+func printServiceStates(ufo *UFO.UFO, deployment *UFO.Deployment) {
+	w := tabwriter.NewWriter(term.Output, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SERVICE\tSTATE\tTASK DEFINITION\t")
+
+	for _, detail := range deployment.DeployDetails {
+		// The deployment's context is canceled, so the state is read without it
+		state, err := ufo.GetServiceState(detail)
+		if err != nil {
+			fmt.Fprintf(w, "%s\tunknown\t%s\t\n", *detail.Service.ServiceName, err)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", *detail.Service.ServiceName, state.State, state.TaskDefinition)
+	}
+
+	w.Flush()
+}
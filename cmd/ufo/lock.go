@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+	"github.com/spf13/cobra"
+)
+
+// lockBuildAllowance is added to the deployment timeout to get the lifetime of a deploy lock,
+// the lock is taken before the image is built
+const lockBuildAllowance = 30 * time.Minute
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Manage the deployment lock of a cluster",
+	Long: `Deploys lock their cluster so two deploys to the same cluster can't race each other.
+	The lock is stored as tags on the ECS cluster with its holder, commit and expiry. It is
+	released when the deploy finishes and ignored once it expires. ECS tags can't be written
+	conditionally, so the lock is best-effort.`,
+}
+
+// lockCluster takes the deployment lock of a cluster for a commit. The lock lasts for rollouts
+// deployment timeouts, the number of rollouts that may run one after the other before the
+// cluster's own rollout ends. The returned function releases the lock.
+func lockCluster(ctx context.Context, ufo *UFO.UFO, cluster *Cluster, commit string, timeout int, rollouts int) (func(), error) {
+	c, err := ufo.GetClusterWithContext(ctx, cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Minute*time.Duration(timeout*rollouts) + lockBuildAllowance
+	lock := UFO.NewLock(newOperation(UFO.OperationDeploy).Deployer, commit, ttl)
+
+	if err := ufo.AcquireLockWithContext(ctx, c, lock); err != nil {
+		return nil, err
+	}
+
+	// The lock is released without the context so it is also released after an interrupt
+	return func() {
+		if err := ufo.ReleaseLock(c, lock); err != nil {
+			logf("Could not release the lock of cluster %s: %s\n", cluster.Name, err)
+		}
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+	"github.com/spf13/cobra"
+)
+
+var flagLockReleaseForce bool
+
+var lockReleaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Release the deployment lock of a cluster",
+	Long: `Releases a lock held by you. The --force flag releases the lock regardless of who
+	holds it, e.g. when a deploy was killed and left its lock behind.`,
+	RunE: runLockRelease,
+}
+
+func runLockRelease(cmd *cobra.Command, args []string) error {
+	cfgCluster, err := cfg.getCluster(flagCluster)
+	if err != nil {
+		return err
+	}
+
+	ufo := UFO.New(awsConfig)
+
+	c, err := ufo.GetCluster(cfgCluster.Name)
+	if err != nil {
+		return err
+	}
+
+	lock, err := ufo.GetLock(c)
+	if err != nil {
+		return err
+	}
+
+	if lock == nil {
+		fmt.Printf("Cluster %s is not locked\n", cfgCluster.Name)
+		return nil
+	}
+
+	if !flagLockReleaseForce && lock.Holder != newOperation(UFO.OperationDeploy).Deployer {
+		return ErrLockHeldByOther
+	}
+
+	if err := ufo.ForceReleaseLock(c); err != nil {
+		return err
+	}
+
+	fmt.Printf("Released the lock of cluster %s held by %s\n", cfgCluster.Name, lock.Holder)
+
+	return nil
+}
+
+func init() {
+	lockCmd.AddCommand(lockReleaseCmd)
+
+	lockReleaseCmd.Flags().BoolVar(&flagLockReleaseForce, "force", false, "Release the lock even if it is held by someone else")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+	"github.com/spf13/cobra"
+)
+
+var lockStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show who holds the deployment lock of a cluster",
+	RunE:  runLockStatus,
+}
+
+func runLockStatus(cmd *cobra.Command, args []string) error {
+	cfgCluster, err := cfg.getCluster(flagCluster)
+	if err != nil {
+		return err
+	}
+
+	ufo := UFO.New(awsConfig)
+
+	c, err := ufo.GetCluster(cfgCluster.Name)
+	if err != nil {
+		return err
+	}
+
+	lock, err := ufo.GetLock(c)
+	if err != nil {
+		return err
+	}
+
+	if lock == nil {
+		fmt.Printf("Cluster %s is not locked\n", cfgCluster.Name)
+		return nil
+	}
+
+	state := "locked"
+	if lock.Expired() {
+		state = "locked (expired)"
+	}
+
+	fmt.Printf("Cluster %s is %s\n", cfgCluster.Name, state)
+	fmt.Printf("  Holder:  %s\n", lock.Holder)
+	fmt.Printf("  Commit:  %s\n", lock.Commit)
+	fmt.Printf("  Expires: %s\n", lock.Expires.Local().Format(time.RFC1123))
+	fmt.Printf("  ID:      %s\n", lock.ID)
+
+	return nil
+}
+
+func init() {
+	lockCmd.AddCommand(lockStatusCmd)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/fuzz-productions/ufo/pkg/notify"
+)
+
+// notification announces an operation on a cluster to the cluster's webhooks when it starts
+// and when it finishes
+type notification struct {
+	webhooks []string
+	payload  notify.Payload
+	started  time.Time
+}
+
+// startNotification posts the started notification of an operation. Clusters that are not
+// configured or have no webhooks are not notified.
+func startNotification(clusterName string, operation string, services []string, commit string) *notification {
+	n := &notification{
+		payload: notify.Payload{
+			Operation: operation,
+			Cluster:   clusterName,
+			Services:  services,
+			Commit:    commit,
+			User:      newOperation(operation).Deployer,
+		},
+		started: time.Now(),
+	}
+
+	if cluster, err := cfg.getCluster(clusterName); err == nil {
+		n.webhooks = cluster.Webhooks
+	}
+
+	n.send(notify.OutcomeStarted, nil)
+
+	return n
+}
+
+// finish posts the outcome of the operation and returns its error unchanged, so a webhook
+// can never fail the operation
+func (n *notification) finish(err error) error {
+	if err != nil {
+		n.send(notify.OutcomeFailed, err)
+	} else {
+		n.send(notify.OutcomeSucceeded, nil)
+	}
+
+	return err
+}
+
+func (n *notification) send(outcome string, err error) {
+	if len(n.webhooks) == 0 {
+		return
+	}
+
+	p := n.payload
+	p.Outcome = outcome
+
+	if outcome != notify.OutcomeStarted {
+		p.Duration = time.Since(n.started).Round(time.Second).Seconds()
+	}
+
+	if err != nil {
+		p.Error = err.Error()
+	}
+
+	for _, err := range notify.Send(n.webhooks, &p) {
+		logf("Warning: could not notify a webhook of cluster %s: %s\n", n.payload.Cluster, err)
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fuzz-productions/ufo/pkg/notify"
+	"github.com/fuzz-productions/ufo/pkg/term"
+)
+
+func TestNotificationFinish(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	output := term.Output
+	defer func() { term.Output = output }()
+
+	cases := []struct {
+		Err error
+	}{
+		{Err: nil},
+		{Err: errors.New("deploy failed")},
+	}
+
+	for i, c := range cases {
+		var buf bytes.Buffer
+		term.Output = &buf
+
+		n := &notification{
+			webhooks: []string{server.URL},
+			payload:  notify.Payload{Operation: "deploy", Cluster: "dev"},
+		}
+
+		if a, e := n.finish(c.Err), c.Err; a != e {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+
+		if !strings.Contains(buf.String(), "Warning: could not notify a webhook of cluster dev") {
+			t.Errorf("%d, expected a warning, got %q", i, buf.String())
+		}
+	}
+}
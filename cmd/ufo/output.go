@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+)
+
+// Output formats of the --output flag
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// reporter receives the events of deploys, promotes and rollbacks
+var reporter UFO.Reporter
+
+// initOutput sets up the reporter for the --output flag. In json mode everything that isn't
+// an event, including docker output, is written to stderr. Masked values are hidden in both.
+func initOutput() {
+	switch flagOutput {
+	case outputText:
+		reporter = &textReporter{w: term.MaskedWriter(os.Stdout)}
+	case outputJSON:
+		term.Output = term.MaskedWriter(os.Stderr)
+		reporter = &jsonReporter{enc: json.NewEncoder(term.MaskedWriter(os.Stdout))}
+	default:
+		handleError(ErrInvalidOutput)
+	}
+}
+
+// newUFO creates a UFO session that reports its events to the reporter of the --output flag
+func newUFO() *UFO.UFO {
+	ufo := UFO.New(awsConfig)
+	ufo.Reporter = reporter
+
+	return ufo
+}
+
+// logf prints progress that isn't an event, it goes to stderr in json mode
+func logf(format string, a ...interface{}) {
+	fmt.Fprintf(term.Output, format, a...)
+}
+
+// reportError reports the error a command failed with as a failed event
+func reportError(err error) error {
+	if err != nil {
+		reporter.Report(&UFO.Event{Type: UFO.EventFailed, Time: time.Now(), Error: err.Error()})
+	}
+
+	return err
+}
+
+// printResults prints the outcome of an operation for every service, it goes to stderr in
+// json mode where the outcomes are reported as events
+func printResults(results UFO.ServiceResults) {
+	w := tabwriter.NewWriter(term.Output, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SERVICE\tRESULT\tERROR\t")
+
+	for _, result := range results {
+		errMsg := "-"
+		if result.Err != nil {
+			errMsg = result.Err.Error()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", *result.Detail.Service.ServiceName, result.Status, errMsg)
+	}
+
+	w.Flush()
+}
+
+// textReporter prints events as human readable lines
+type textReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (r *textReporter) Report(e *UFO.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e.Type {
+	case UFO.EventBuildStarted:
+		fmt.Fprintf(r.w, "Building image %s\n", e.Image)
+	case UFO.EventImagePushed:
+		if e.Digest != "" {
+			fmt.Fprintf(r.w, "Pushed image %s (%s)\n", e.Image, e.Digest)
+		} else {
+			fmt.Fprintf(r.w, "Pushed image %s\n", e.Image)
+		}
+	case UFO.EventTaskDefinitionRegistered:
+		fmt.Fprintf(r.w, "Registered %s for service %s\n", e.TaskDefinition, e.Service)
+	case UFO.EventServiceUpdated:
+		fmt.Fprintf(r.w, "Updated service %s to %s\n", e.Service, e.TaskDefinition)
+	case UFO.EventServiceProgress:
+		p := e.Progress
+		fmt.Fprintf(r.w, "Service %s (%s): %d/%d running, %d pending, %d old task(s) draining\n", e.Service, e.TaskDefinition, p.Running, p.Desired, p.Pending, p.Draining)
+	case UFO.EventServiceStable:
+		fmt.Fprintf(r.w, "Service %s (%s) is now running\n", e.Service, e.TaskDefinition)
+	case UFO.EventServiceRolledBack:
+		fmt.Fprintf(r.w, "Service %s rolled back to %s\n", e.Service, e.TaskDefinition)
+	case UFO.EventWarning:
+		fmt.Fprintf(r.w, "Warning: service %s (%s): %s\n", e.Service, e.TaskDefinition, e.Error)
+	case UFO.EventFailed:
+		// The error a command fails with is printed when it exits
+		if e.Service != "" {
+			fmt.Fprintf(r.w, "Service %s (%s) failed: %s\n", e.Service, e.TaskDefinition, e.Error)
+		} else if e.Image != "" {
+			fmt.Fprintf(r.w, "Image %s failed: %s\n", e.Image, e.Error)
+		}
+	}
+}
+
+// jsonReporter prints every event as a JSON object on its own line
+type jsonReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (r *jsonReporter) Report(e *UFO.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.enc.Encode(e)
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagPromoteFrom string
+	flagPromoteTo   string
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Promote the running image of one cluster to another",
+	Long: `The clusters must be specified via the --from and --to flags.
+	Every service of the --to cluster is deployed with the image tag currently running
+	in the services of the --from cluster. Nothing is built, so no git checkout or docker
+	daemon is needed.
+	The image has to pass the vulnerability scan of the --to cluster, like it does on deploy.
+	The --dry-run, --auto-rollback and --revert-on-failure flags behave like they do for deploy.`,
+	RunE: runPromote,
+}
+
+func runPromote(cmd *cobra.Command, args []string) error {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	return reportError(promote(ctx, flagPromoteFrom, flagPromoteTo, flagTimeout))
+}
+
+func promote(ctx context.Context, fromName string, toName string, timeout int) error {
+	ufo := newUFO()
+
+	from, err := cfg.getCluster(fromName)
+	if err != nil {
+		return err
+	}
+
+	to, err := cfg.getCluster(toName)
+	if err != nil {
+		return err
+	}
+
+	if err := checkScanSettings(to); err != nil {
+		return err
+	}
+
+	tag, err := runningImageTag(ctx, ufo, from)
+	if err != nil {
+		return err
+	}
+
+	exists, err := ufo.ImageExistsWithContext(ctx, cfg.Repo, tag)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrImageNotFound
+	}
+
+	logf("Promoting %s:%s from %s to %s\n", cfg.Repo, tag, from.Name, to.Name)
+
+	deployment := &UFO.Deployment{}
+	deployment.SetOperation(newOperation(UFO.OperationDeploy))
+	deployment.SetCommitHash(tag)
+	deployment.SetRepo(cfg.Repo)
+	deployment.SetContainerRepos(cfg.getContainerRepos(to.Name))
+
+	err = resolveDeployDetails(ctx, ufo, to, to.Services, deployment)
+	if err != nil {
+		return err
+	}
+
+	if flagDeployDryRun {
+		plans, err := ufo.PlanAll(deployment)
+		if err != nil {
+			return err
+		}
+
+		printPlans(plans)
+
+		return nil
+	}
+
+	release, err := lockCluster(ctx, ufo, to, tag, timeout, 1)
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	n := startNotification(to.Name, UFO.OperationDeploy, to.Services, tag)
+
+	// The image passed the scan of the cluster it is promoted from, not necessarily this one
+	d := &clusterDeploy{cluster: to, services: to.Services, deployment: deployment, notification: n}
+
+	if err := scanImage(ctx, ufo, []*clusterDeploy{d}, timeout); err != nil {
+		return n.finish(interrupted(ctx, ufo, deployment, err))
+	}
+
+	if flagOutput == outputText {
+		term.Clear()
+	}
+
+	err = rolloutCluster(ctx, ufo, d, timeout)
+
+	return n.finish(interrupted(ctx, ufo, deployment, err))
+}
+
+// runningImageTag returns the image tag every service of a cluster is running. The tag is read
+// from the first configured container, or the first container of the task definition.
+func runningImageTag(ctx context.Context, ufo *UFO.UFO, cluster *Cluster) (string, error) {
+	container := appContainer(cluster)
+
+	c, err := ufo.GetClusterWithContext(ctx, cluster.Name)
+	if err != nil {
+		return "", err
+	}
+
+	tag := ""
+
+	for _, service := range cluster.Services {
+		s, err := ufo.GetServiceWithContext(ctx, c, service)
+		if err != nil {
+			return "", err
+		}
+
+		serviceTag, err := ufo.GetLastDeployedCommitForContainerWithContext(ctx, *s.TaskDefinition, container)
+		if err != nil {
+			return "", err
+		}
+
+		if tag != "" && tag != serviceTag {
+			return "", ErrPromoteMixedImages
+		}
+
+		tag = serviceTag
+	}
+
+	if tag == "" {
+		return "", ErrServiceNotFound
+	}
+
+	return tag, nil
+}
+
+func init() {
+	rootCmd.AddCommand(promoteCmd)
+
+	promoteCmd.Flags().StringVar(&flagPromoteFrom, "from", "", "Cluster to read the running image from")
+	promoteCmd.Flags().StringVar(&flagPromoteTo, "to", "", "Cluster to deploy the image to")
+	promoteCmd.Flags().BoolVar(&flagDeployDryRun, "dry-run", false, "Print the task definition changes without deploying")
+	promoteCmd.Flags().BoolVar(&flagDeployAutoRollback, "auto-rollback", false, "Roll back all services when the deployment fails or times out")
+	promoteCmd.Flags().BoolVar(&flagDeployRevertOnFailure, "revert-on-failure", false, "Revert the services that were updated when another service could not be updated")
+	promoteCmd.MarkFlagRequired("from")
+	promoteCmd.MarkFlagRequired("to")
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+)
+
+// mockedRunningImages runs every service with the task definition of the same name, whose
+// containers run the images in images
+type mockedRunningImages struct {
+	ecsiface.ECSAPI
+	images map[string]map[string]string
+}
+
+func (m mockedRunningImages) DescribeClustersWithContext(ctx aws.Context, in *ecs.DescribeClustersInput, opts ...request.Option) (*ecs.DescribeClustersOutput, error) {
+	return &ecs.DescribeClustersOutput{
+		Clusters: []*ecs.Cluster{{ClusterName: in.Clusters[0], ClusterArn: in.Clusters[0]}},
+	}, nil
+}
+
+func (m mockedRunningImages) DescribeServicesWithContext(ctx aws.Context, in *ecs.DescribeServicesInput, opts ...request.Option) (*ecs.DescribeServicesOutput, error) {
+	return &ecs.DescribeServicesOutput{
+		Services: []*ecs.Service{{ServiceName: in.Services[0], TaskDefinition: in.Services[0]}},
+	}, nil
+}
+
+func (m mockedRunningImages) DescribeTaskDefinitionWithContext(ctx aws.Context, in *ecs.DescribeTaskDefinitionInput, opts ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	t := &ecs.TaskDefinition{TaskDefinitionArn: in.TaskDefinition}
+
+	for _, name := range []string{"log-router", "app"} {
+		if image, ok := m.images[*in.TaskDefinition][name]; ok {
+			t.ContainerDefinitions = append(t.ContainerDefinitions, &ecs.ContainerDefinition{Name: aws.String(name), Image: aws.String(image)})
+		}
+	}
+
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: t}, nil
+}
+
+func TestRunningImageTag(t *testing.T) {
+	repo := "111222333444.dkr.ecr.us-west-1.amazonaws.com/app"
+	images := map[string]map[string]string{
+		"api":    {"log-router": "amazon/aws-for-fluent-bit:latest", "app": repo + ":ea13366"},
+		"worker": {"log-router": "amazon/aws-for-fluent-bit:latest", "app": repo + ":ea13366"},
+		"cron":   {"log-router": "amazon/aws-for-fluent-bit:latest", "app": repo + ":b4c7e21"},
+	}
+
+	cases := []struct {
+		Cluster  *Cluster
+		Expected string
+		Error    error
+	}{
+		{
+			Cluster:  &Cluster{Name: "staging", Services: []string{"api", "worker"}, Containers: []*Container{{Name: "app"}}},
+			Expected: "ea13366",
+		},
+		{
+			Cluster:  &Cluster{Name: "staging", Services: []string{"api"}},
+			Expected: "latest",
+		},
+		{
+			Cluster: &Cluster{Name: "staging", Services: []string{"api", "cron"}, Containers: []*Container{{Name: "app"}}},
+			Error:   ErrPromoteMixedImages,
+		},
+		{
+			Cluster: &Cluster{Name: "staging", Services: []string{}},
+			Error:   ErrServiceNotFound,
+		},
+	}
+
+	for i, c := range cases {
+		ufo := &UFO.UFO{ECS: mockedRunningImages{images: images}}
+
+		tag, err := runningImageTag(context.Background(), ufo, c.Cluster)
+
+		if a, e := err, c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, a)
+		}
+
+		if a, e := tag, c.Expected; a != e {
+			t.Errorf("%d, expected tag %q, got %q", i, e, a)
+		}
+	}
+}
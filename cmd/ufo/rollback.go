@@ -1,8 +1,7 @@
 package cmd
 
 import (
-	"fmt"
-	"time"
+	"context"
 
 	"github.com/fuzz-productions/ufo/pkg/term"
 	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
@@ -16,82 +15,63 @@ var rollbackCmd = &cobra.Command{
 	Short: "Rollback a deployment",
 	Long: `A cluster must be specified via the --cluster flag.
 	The --verbose flag can be input to enable verbose output.
-	The --login flag can be input to login to AWS ECR.`,
+	The --login flag can be input to login to AWS ECR.
+	One or more --service flags roll back only those services of the cluster.`,
 	RunE: runRollback,
 }
 
 func runRollback(cmd *cobra.Command, args []string) error {
-	return rollback(flagCluster, flagTimeout)
+	ctx, stop := interruptContext()
+	defer stop()
+
+	return reportError(rollback(ctx, flagCluster, flagTimeout))
 }
 
-func rollback(clusterName string, timeout int) error {
-	ufo := UFO.New(awsConfig)
+func rollback(ctx context.Context, clusterName string, timeout int) error {
+	ufo := newUFO()
 
 	cluster, err := cfg.getCluster(clusterName)
 	if err != nil {
 		return err
 	}
 
+	services, err := cfg.getSelectedServices(cluster, flagServices)
+	if err != nil {
+		return err
+	}
+
 	deployDetail := &UFO.DeployDetail{}
 	deployDetail.SetRevisionNumber(revisionNumber)
 
 	deployment := &UFO.Deployment{}
+	deployment.SetOperation(newOperation(UFO.OperationRollback))
 
-	for _, service := range cluster.Services {
-		detail := ufo.NewDeployDetail()
-
-		// Get the ECS Cluster
-		ecsCluster, err := ufo.GetCluster(cluster.Name)
-		if err != nil {
-			return err
-		}
-
-		// Set the Cluster in the deployment detail
-		detail.SetCluster(ecsCluster)
-
-		// Get the ECS Service
-		ecsService, err := ufo.GetService(detail.Cluster, service)
-		if err != nil {
-			return err
-		}
-
-		// Set the Service in the deployment detail
-		detail.SetService(ecsService)
-
-		// Get the Service's TaskDefinition
-		// if revision set here
-		ecsTaskDef, err := ufo.GetTaskDefinition(detail.Cluster, detail.Service)
-		if err != nil {
-			return err
-		}
-
-		// Set the TaskDefinition in the deployment detail
-		detail.SetTaskDefinition(ecsTaskDef)
-
-		deployment.DeployDetails = append(deployment.DeployDetails, detail)
+	err = resolveDeployDetails(ctx, ufo, cluster, services, deployment)
+	if err != nil {
+		return err
 	}
 
-	term.Clear()
+	n := startNotification(cluster.Name, UFO.OperationRollback, services, "")
 
-	errCh := ufo.RollbackAll(deployment, deployDetail)
+	return n.finish(rollbackServices(ctx, ufo, deployment, deployDetail, timeout))
+}
 
-	for err := range errCh {
-		return err
+// rollbackServices moves every service of a resolved deployment to the revision of the deploy
+// detail and waits for them to run
+func rollbackServices(ctx context.Context, ufo *UFO.UFO, deployment *UFO.Deployment, deployDetail *UFO.DeployDetail, timeout int) error {
+	if flagOutput == outputText {
+		term.Clear()
 	}
 
-	fmt.Printf("Waiting for deployment(s) to services [ %s]\n", deployment.Services())
-	doneCh := ufo.AwaitServicesRunning(deployment)
-
-	for i := 0; i < len(deployment.DeployDetails); i++ {
-		select {
-		case detail := <-doneCh:
-			fmt.Printf("Service %s (%s) is now running \n", *detail.Service.ServiceName, detail.TaskDefinitionFamilyName)
-		case <-time.After(time.Minute * time.Duration(timeout)):
-			return ErrDeployTimeout
-		}
+	results := ufo.RollbackAllWithContext(ctx, deployment, deployDetail)
+	if err := results.Err(); err != nil {
+		printResults(results)
+		return interrupted(ctx, ufo, deployment, err)
 	}
 
-	return nil
+	logf("Waiting for deployment(s) to services [ %s]\n", deployment.Services())
+
+	return interrupted(ctx, ufo, deployment, awaitServices(ctx, ufo, deployment, timeout))
 }
 
 func init() {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/spf13/viper"
 
+	"github.com/fuzz-productions/ufo/pkg/term"
 	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
 	"github.com/spf13/cobra"
 )
@@ -19,8 +20,10 @@ var (
 var (
 	flagCluster    string
 	flagService    string
+	flagServices   []string
 	flagConfigName string
 	flagTimeout    int
+	flagOutput     string
 )
 
 // RootCmd represents the base command when called
@@ -36,20 +39,21 @@ var rootCmd = &cobra.Command{
 // This is called by main.main(). It only needs to happen once to the RootCmd
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(term.Output, err)
 		os.Exit(-1)
 	}
 }
 
 func init() {
-	cobra.OnInitialize(loadConfig)
+	cobra.OnInitialize(loadConfig, initOutput, initService)
 	// Here you will define your flags and configuration settings
 	// Cobra supports Persistent Flags which if defined here will be global for your application
 
 	rootCmd.PersistentFlags().StringVarP(&flagCluster, "cluster", "c", "", "AWS ECS Cluster")
-	rootCmd.PersistentFlags().StringVarP(&flagService, "service", "s", "", "Service in an ECS cluster")
+	rootCmd.PersistentFlags().StringSliceVarP(&flagServices, "service", "s", []string{}, "Service in an ECS cluster, deploy and rollback accept several")
 	rootCmd.PersistentFlags().StringVar(&flagConfigName, "config", "config", "ufo config name")
 	rootCmd.PersistentFlags().IntVarP(&flagTimeout, "timeout", "t", 5, "Deployment Timeout Time")
+	rootCmd.PersistentFlags().StringVarP(&flagOutput, "output", "o", outputText, "Output format, text or json")
 }
 
 func loadConfig() {
@@ -76,3 +80,21 @@ func loadConfig() {
 		Region:  cfg.Region,
 	}
 }
+
+// initService sets the service of commands that work on a single service to the --service
+// value, see checkSingleService
+func initService() {
+	if len(flagServices) > 0 {
+		flagService = flagServices[0]
+	}
+}
+
+// checkSingleService returns an error when a command that works on a single service is given
+// several services
+func checkSingleService(selected []string) error {
+	if len(selected) > 1 {
+		return ErrSingleService
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import "testing"
+
+func TestCheckSingleService(t *testing.T) {
+	cases := []struct {
+		Selected []string
+		Error    error
+	}{
+		{Selected: []string{}},
+		{Selected: []string{"api"}},
+		{Selected: []string{"api", "worker"}, Error: ErrSingleService},
+	}
+
+	for i, c := range cases {
+		if a, e := checkSingleService(c.Selected), c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, a)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+	UFO "github.com/fuzz-productions/ufo/pkg/ufo"
+)
+
+// checkScanSettings returns an error when a cluster has a scan severity threshold that ECR
+// doesn't know
+func checkScanSettings(cluster *Cluster) error {
+	if cluster.Scan == nil || cluster.Scan.Severity == "" {
+		return nil
+	}
+
+	return UFO.CheckSeverity(cluster.Scan.Severity)
+}
+
+// scanImage waits for the vulnerability scans of the deployed images when a cluster
+// configures a scan and prints a summary of their findings. Every repo a scanned cluster
+// deploys from is scanned once. A cluster whose severity threshold the findings of one of
+// its repos exceed is blocked and won't be rolled out to.
+func scanImage(ctx context.Context, ufo *UFO.UFO, deploys []*clusterDeploy, timeout int) error {
+	start := false
+	repos := []string{}
+	seen := map[string]bool{}
+
+	// The repos each scanned cluster deploys from
+	clusterRepos := map[*clusterDeploy]map[string]bool{}
+
+	for _, d := range deploys {
+		if d.cluster.Scan == nil {
+			continue
+		}
+
+		start = start || d.cluster.Scan.Start
+		clusterRepos[d] = map[string]bool{}
+
+		for _, repo := range d.deployment.Repos() {
+			clusterRepos[d][repo] = true
+
+			if !seen[repo] {
+				seen[repo] = true
+				repos = append(repos, repo)
+			}
+		}
+	}
+
+	if len(repos) == 0 {
+		return nil
+	}
+
+	tag := deploys[0].deployment.BuildDetail.CommitHash
+
+	scanCtx, cancel := context.WithTimeout(ctx, time.Minute*time.Duration(timeout))
+	defer cancel()
+
+	// The blocking findings of each cluster
+	blocked := map[*clusterDeploy][]string{}
+
+	for _, repo := range repos {
+		logf("Waiting for the vulnerability scan of image %s:%s\n", repo, tag)
+
+		result, err := ufo.ScanImageWithContext(scanCtx, repo, tag, start)
+		if err != nil {
+			return err
+		}
+
+		// The clusters each finding blocks
+		blocks := map[*UFO.ScanFinding][]string{}
+
+		for _, d := range deploys {
+			if !clusterRepos[d][repo] || d.cluster.Scan.Severity == "" {
+				continue
+			}
+
+			findings, err := result.Blocking(d.cluster.Scan.Severity, d.cluster.Scan.Allow)
+			if err != nil {
+				return err
+			}
+
+			for _, finding := range findings {
+				blocked[d] = append(blocked[d], finding.Name)
+				blocks[finding] = append(blocks[finding], d.cluster.Name)
+			}
+		}
+
+		printScanResult(result, blocks)
+	}
+
+	for d, names := range blocked {
+		d.blocked = fmt.Errorf("%s: %s", ErrScanFindings, strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// printScanResult prints the number of findings per severity and the findings that block a
+// cluster, it goes to stderr in json mode
+func printScanResult(result *UFO.ScanResult, blocks map[*UFO.ScanFinding][]string) {
+	w := tabwriter.NewWriter(term.Output, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SEVERITY\tFINDINGS\t")
+
+	for _, severity := range UFO.ScanSeverities {
+		fmt.Fprintf(w, "%s\t%d\t\n", severity, result.Counts[severity])
+	}
+
+	w.Flush()
+
+	if len(blocks) == 0 {
+		return
+	}
+
+	fmt.Fprintln(term.Output)
+
+	w = tabwriter.NewWriter(term.Output, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "FINDING\tSEVERITY\tPACKAGE\tBLOCKS\t")
+
+	for _, finding := range result.Findings {
+		clusters, ok := blocks[finding]
+		if !ok {
+			continue
+		}
+
+		pkg := finding.Package
+		if pkg == "" {
+			pkg = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", finding.Name, finding.Severity, pkg, strings.Join(clusters, ", "))
+	}
+
+	w.Flush()
+}
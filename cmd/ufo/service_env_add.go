@@ -23,6 +23,16 @@ var serviceAddEnvCmd = &cobra.Command{
 }
 
 func addEnvVar(cmd *cobra.Command, args []string) error {
+	if err := checkSingleService(flagServices); err != nil {
+		return err
+	}
+
+	n := startNotification(flagCluster, UFO.OperationEnv, []string{flagService}, "")
+
+	return n.finish(addEnvVars())
+}
+
+func addEnvVars() error {
 	u := UFO.New(awsConfig)
 
 	c, err := u.GetCluster(flagCluster)
@@ -49,7 +59,7 @@ func addEnvVar(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	registeredDefinition, err := u.RegisterTaskDefinitionWithEnvVars(updatedDefinition)
+	registeredDefinition, err := u.RegisterTaskDefinitionWithEnvVars(updatedDefinition, newOperation(UFO.OperationEnv))
 
 	if err != nil {
 		return err
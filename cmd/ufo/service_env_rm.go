@@ -22,6 +22,16 @@ var serviceRmEnvCmd = &cobra.Command{
 }
 
 func rmEnv(cmd *cobra.Command, args []string) error {
+	if err := checkSingleService(flagServices); err != nil {
+		return err
+	}
+
+	n := startNotification(flagCluster, UFO.OperationEnv, []string{flagService}, "")
+
+	return n.finish(rmEnvVars())
+}
+
+func rmEnvVars() error {
 	u := UFO.New(awsConfig)
 
 	c, err := u.GetCluster(flagCluster)
@@ -48,7 +58,7 @@ func rmEnv(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	registeredDefinition, err := u.RegisterTaskDefinitionWithEnvVars(newDefinition)
+	registeredDefinition, err := u.RegisterTaskDefinitionWithEnvVars(newDefinition, newOperation(UFO.OperationEnv))
 
 	if err != nil {
 		return err
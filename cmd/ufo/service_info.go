@@ -20,6 +20,8 @@ func listInfo(cmd *cobra.Command, args []string) {
 
 	handleError(err)
 
+	handleError(checkSingleService(flagServices))
+
 	cfgService, err := cfg.getService(cfgCluster.Services, flagService)
 
 	handleError(err)
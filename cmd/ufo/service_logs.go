@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -81,10 +82,13 @@ func getOrFollowLogs(cmd *cobra.Command, args []string) {
 	o.AddStartTime(flagServiceLogsStartTime)
 	o.AddEndTime(flagServiceLogsEndTime)
 
+	ctx, stop := interruptContext()
+	defer stop()
+
 	if flagServiceLogsFollow {
-		followLogs(o)
+		followLogs(ctx, o)
 	} else {
-		getLogs(o)
+		getLogs(ctx, o)
 	}
 }
 
@@ -146,25 +150,31 @@ func (o *LogsOperation) parseTime(rawTime string) (time.Time, error) {
 	return t, ErrCouldNotParseTime
 }
 
-func followLogs(o *LogsOperation) {
+// followLogs prints new log events every second until ctx is canceled
+func followLogs(ctx context.Context, o *LogsOperation) {
 	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
 	if o.StartTime.IsZero() {
 		o.StartTime = time.Now()
 	}
 
 	for {
-		getLogs(o)
+		getLogs(ctx, o)
 
 		if newStartTime := time.Now().Add(-10 * time.Second); newStartTime.After(o.StartTime) {
 			o.StartTime = newStartTime
 		}
 
-		<-ticker.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
-func getLogs(o *LogsOperation) {
+func getLogs(ctx context.Context, o *LogsOperation) {
 	u := UFO.New(awsConfig)
 
 	in := &ufo.GetLogsInput{
@@ -175,7 +185,7 @@ func getLogs(o *LogsOperation) {
 		EndTime:        o.EndTime,
 	}
 
-	logs, _ := u.GetLogs(in)
+	logs, _ := u.GetLogsWithContext(ctx, in)
 
 	for _, logLine := range logs {
 		if !o.SeenEvent(logLine.EventID) {
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fuzz-productions/ufo/pkg/git"
+)
+
+// Tag strategies of a cluster's image
+const (
+	tagFullSHA   = "full-sha"
+	tagShortSHA  = "short-sha"
+	tagBranch    = "branch"
+	tagSemver    = "semver"
+	tagTimestamp = "timestamp"
+)
+
+// invalidTagChars matches the characters a docker tag can't contain
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// imageTags returns the tags of a cluster's image for a commit. The first tag is the tag of
+// the first immutable strategy of the cluster and is used by the task definitions, the other
+// tags are pushed as well. The moving tag of the cluster is not included, see movingTag. A
+// dirty build only gets the immutable tag with a -dirty-<timestamp> suffix.
+func imageTags(cluster *Cluster, commit string, ref string, dirty bool, built time.Time) (string, []string, error) {
+	strategies := cluster.Tags
+	if len(strategies) == 0 {
+		strategies = []string{tagShortSHA}
+	}
+
+	immutable := ""
+	tags := []string{}
+
+	for _, strategy := range strategies {
+		tag, err := strategyTag(strategy, commit, ref, built)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if tag == "" {
+			continue
+		}
+
+		if immutable == "" && strategy != tagBranch {
+			immutable = tag
+			continue
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if immutable == "" {
+		return "", nil, ErrNoImmutableTag
+	}
+
+	if dirty {
+		return fmt.Sprintf("%s-dirty-%s", immutable, built.Format(dirtyTimeFormat)), nil, nil
+	}
+
+	return immutable, tags, nil
+}
+
+// movingTag returns the moving tag of a cluster. It is moved to the image once the cluster runs
+// it, so it never points to an image the cluster was not deployed with. A dirty build has no
+// moving tag, so it never points to uncommitted changes.
+func movingTag(cluster *Cluster, dirty bool) string {
+	if dirty {
+		return ""
+	}
+
+	return cluster.MovingTag
+}
+
+// strategyTag returns the tag of a single strategy. The branch tag is empty when HEAD is
+// detached.
+func strategyTag(strategy string, commit string, ref string, built time.Time) (string, error) {
+	switch strategy {
+	case tagShortSHA:
+		return commit, nil
+	case tagFullSHA:
+		return git.GetFullCommit(commit)
+	case tagSemver:
+		tag, err := git.Describe(commit)
+		return sanitizeTag(tag), err
+	case tagTimestamp:
+		return built.Format(dirtyTimeFormat), nil
+	case tagBranch:
+		branch := ref
+		if branch == "" {
+			b, err := git.GetBranch()
+			if err != nil {
+				return "", err
+			}
+
+			branch = b
+		}
+
+		if branch == "HEAD" {
+			logf("Warning: HEAD is detached, the image is not tagged with a branch\n")
+			return "", nil
+		}
+
+		return sanitizeTag(branch), nil
+	}
+
+	return "", fmt.Errorf("%s: %s", ErrInvalidTagStrategy, strategy)
+}
+
+// sanitizeTag replaces the characters a docker tag can't contain, e.g. the slash of
+// feature/login becomes feature-login
+func sanitizeTag(tag string) string {
+	tag = strings.TrimLeft(invalidTagChars.ReplaceAllString(tag, "-"), ".-")
+
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+
+	return tag
+}
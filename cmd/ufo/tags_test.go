@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+)
+
+func TestImageTags(t *testing.T) {
+	output := term.Output
+	term.Output = ioutil.Discard
+	defer func() { term.Output = output }()
+
+	built := time.Date(2026, 10, 17, 14, 2, 11, 0, time.UTC)
+
+	cases := []struct {
+		Cluster  *Cluster
+		Ref      string
+		Dirty    bool
+		Expected string
+		Tags     []string
+		Error    string
+	}{
+		{
+			Cluster:  &Cluster{},
+			Expected: "a1b2c3d",
+			Tags:     []string{},
+		},
+		{
+			Cluster:  &Cluster{Tags: []string{tagShortSHA, tagBranch, tagTimestamp}},
+			Ref:      "feature/login",
+			Expected: "a1b2c3d",
+			Tags:     []string{"feature-login", "20261017140211"},
+		},
+		{
+			Cluster:  &Cluster{Tags: []string{tagBranch, tagTimestamp}},
+			Ref:      "main",
+			Expected: "20261017140211",
+			Tags:     []string{"main"},
+		},
+		{
+			Cluster:  &Cluster{Tags: []string{tagShortSHA}, MovingTag: "dev-latest"},
+			Expected: "a1b2c3d",
+			Tags:     []string{},
+		},
+		{
+			Cluster:  &Cluster{Tags: []string{tagShortSHA, tagBranch}},
+			Ref:      "HEAD",
+			Expected: "a1b2c3d",
+			Tags:     []string{},
+		},
+		{
+			Cluster:  &Cluster{Tags: []string{tagShortSHA, tagBranch}, MovingTag: "dev-latest"},
+			Ref:      "main",
+			Dirty:    true,
+			Expected: "a1b2c3d-dirty-20261017140211",
+		},
+		{
+			Cluster: &Cluster{Tags: []string{tagBranch}},
+			Ref:     "main",
+			Error:   ErrNoImmutableTag.Error(),
+		},
+		{
+			Cluster: &Cluster{Tags: []string{"latest"}},
+			Error:   ErrInvalidTagStrategy.Error() + ": latest",
+		},
+	}
+
+	for i, c := range cases {
+		tag, tags, err := imageTags(c.Cluster, "a1b2c3d", c.Ref, c.Dirty, built)
+
+		if c.Error == "" && err != nil {
+			t.Errorf("%d, expected no error, got %s", i, err)
+		} else if c.Error != "" && (err == nil || err.Error() != c.Error) {
+			t.Errorf("%d, expected error %s, got %v", i, c.Error, err)
+		}
+
+		if a, e := tag, c.Expected; a != e {
+			t.Errorf("%d, expected tag %q, got %q", i, e, a)
+		}
+
+		if a, e := tags, c.Tags; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected tags %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestMovingTag(t *testing.T) {
+	cases := []struct {
+		Cluster  *Cluster
+		Dirty    bool
+		Expected string
+	}{
+		{Cluster: &Cluster{}, Expected: ""},
+		{Cluster: &Cluster{MovingTag: "prod-latest"}, Expected: "prod-latest"},
+		{Cluster: &Cluster{MovingTag: "prod-latest"}, Dirty: true, Expected: ""},
+	}
+
+	for i, c := range cases {
+		if a, e := movingTag(c.Cluster, c.Dirty), c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
+
+func TestStrategyTag(t *testing.T) {
+	output := term.Output
+	term.Output = ioutil.Discard
+	defer func() { term.Output = output }()
+
+	built := time.Date(2026, 10, 17, 14, 2, 11, 0, time.UTC)
+
+	cases := []struct {
+		Strategy string
+		Ref      string
+		Expected string
+		Error    bool
+	}{
+		{Strategy: tagShortSHA, Expected: "a1b2c3d"},
+		{Strategy: tagTimestamp, Expected: "20261017140211"},
+		{Strategy: tagBranch, Ref: "release/1.4", Expected: "release-1.4"},
+		{Strategy: tagBranch, Ref: "HEAD", Expected: ""},
+		{Strategy: "commit", Error: true},
+	}
+
+	for i, c := range cases {
+		tag, err := strategyTag(c.Strategy, "a1b2c3d", c.Ref, built)
+
+		if a, e := err != nil, c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, err)
+		}
+
+		if a, e := tag, c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
+
+func TestSanitizeTag(t *testing.T) {
+	cases := []struct {
+		Tag      string
+		Expected string
+	}{
+		{Tag: "main", Expected: "main"},
+		{Tag: "v1.4.0-3-ga1b2c3d", Expected: "v1.4.0-3-ga1b2c3d"},
+		{Tag: "feature/login", Expected: "feature-login"},
+		{Tag: "fix/#123 crash", Expected: "fix--123-crash"},
+		{Tag: ".hidden", Expected: "hidden"},
+		{Tag: "-/leading", Expected: "leading"},
+		{Tag: "_underscore", Expected: "_underscore"},
+		{Tag: strings.Repeat("a", 200), Expected: strings.Repeat("a", 128)},
+	}
+
+	for i, c := range cases {
+		if a, e := sanitizeTag(c.Tag), c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 
@@ -26,45 +27,50 @@ func runTask(cmd *cobra.Command, args []string) {
 
 	handleError(err)
 
+	handleError(checkSingleService(flagServices))
+
 	cfgService, err := cfg.getService(cfgCluster.Services, flagService)
 
 	handleError(err)
 
+	ctx, stop := interruptContext()
+	defer stop()
+
 	// Check if the command is available in the config as a shortcut
 	command, err := cfg.getCommand(flagTaskCommand)
 
 	// If the shortcut is not in the config, pass the command directly
 	if err != nil {
-		err = run(cfgCluster.Name, *cfgService, flagTaskCommand)
+		err = run(ctx, cfgCluster.Name, *cfgService, flagTaskCommand)
 	} else {
-		err = run(cfgCluster.Name, *cfgService, *command)
+		err = run(ctx, cfgCluster.Name, *cfgService, *command)
 	}
 
 	handleError(err)
 }
 
-func run(cluster string, service string, command string) error {
+func run(ctx context.Context, cluster string, service string, command string) error {
 	ufo := UFO.New(awsConfig)
 
-	c, err := ufo.GetCluster(cluster)
+	c, err := ufo.GetClusterWithContext(ctx, cluster)
 
 	if err != nil {
 		return err
 	}
 
-	s, err := ufo.GetService(c, service)
+	s, err := ufo.GetServiceWithContext(ctx, c, service)
 
 	if err != nil {
 		return err
 	}
 
-	t, err := ufo.GetTaskDefinition(c, s)
+	t, err := ufo.GetTaskDefinitionWithContext(ctx, c, s)
 
 	if err != nil {
 		return err
 	}
 
-	taskOutput, err := ufo.RunTask(c, t, command)
+	taskOutput, err := ufo.RunTaskWithContext(ctx, c, t, command)
 
 	if err != nil {
 		return err
@@ -72,7 +78,7 @@ func run(cluster string, service string, command string) error {
 
 	fmt.Printf("Running task on cluster %s with command %s\n", cluster, command)
 
-	td, err := ufo.GetTaskDefinition(c, s)
+	td, err := ufo.GetTaskDefinitionWithContext(ctx, c, s)
 
 	if err != nil {
 		return err
@@ -99,17 +105,21 @@ func run(cluster string, service string, command string) error {
 	waiting := make(chan error)
 
 	go func() {
-		waiting <- ufo.IsTaskRunning(c.ClusterArn, &taskID)
+		waiting <- ufo.IsTaskRunningWithContext(ctx, c.ClusterArn, &taskID)
 	}()
 
 	go func() {
-		followLogs(o)
+		followLogs(ctx, o)
 	}()
 
 	loop := false
 	for !loop {
 		select {
 		case err := <-waiting:
+			if ctx.Err() != nil {
+				return ErrTaskInterrupted
+			}
+
 			if err != nil {
 				return err
 			}
@@ -2,47 +2,168 @@ package docker
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/fuzz-productions/ufo/pkg/term"
 )
 
-// ImageBuild builds a docker image based on the configured dockerfile for
-// the cluster you are deploying to and tags the image with the vcs head
-func ImageBuild(repo string, tag string, dockerfile string, buildArgs []string, configBuildArgs []string) error {
-	image := fmt.Sprintf("%s:%s", repo, tag)
+// BuildOptions configures an image build
+type BuildOptions struct {
+	Repo            string
+	Tag             string
+	Tags            []string
+	Dockerfile      string
+	Dir             string
+	BuildArgs       []string
+	ConfigBuildArgs []string
+	CacheFrom       []string
+	Platforms       []string
+	Context         string
+	Target          string
+	Labels          []string
+	Secrets         []string
+	SSH             []string
+}
 
-	dockerConfigBuildArgs := make([]string, 2*len(configBuildArgs), 2*len(configBuildArgs))
-	dockerBuildArgs := make([]string, 2*len(buildArgs), 2*len(buildArgs))
+// buildContext returns the build context directory relative to opts.Dir
+func (opts *BuildOptions) buildContext() string {
+	if opts.Context == "" {
+		return "."
+	}
 
-	for i, v := range configBuildArgs {
+	return opts.Context
+}
 
-		dockerConfigBuildArgs[i*2] = "--build-arg"
-		dockerConfigBuildArgs[i*2+1] = v
+// needsBuildKit returns true when a build uses features of BuildKit
+func (opts *BuildOptions) needsBuildKit() bool {
+	return len(opts.CacheFrom) > 0 || len(opts.Secrets) > 0 || len(opts.SSH) > 0
+}
 
+// ImageBuild builds a docker image based on the configured dockerfile for
+// the cluster you are deploying to and tags the image with opts.Tag and
+// every additional tag in opts.Tags.
+// The build runs in opts.Dir, or the current directory when it is empty, with
+// opts.Context as the build context and the dockerfile relative to opts.Dir.
+// Images in opts.CacheFrom are used as layer cache. The build then runs with BuildKit
+// and writes inline cache metadata, so the pushed image can be the cache of the next build.
+// Builds with opts.Secrets or opts.SSH run with BuildKit as well.
+func ImageBuild(opts *BuildOptions) error {
+	dockerCmdArgs := imageBuildArgs(opts)
+
+	cmd := exec.Command("docker", dockerCmdArgs...)
+	cmd.Dir = opts.Dir
+
+	echo(dockerCmdArgs)
+
+	if opts.needsBuildKit() {
+		cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
 	}
 
-	for i, v := range buildArgs {
+	// BuildKit writes its progress and step errors to stderr
+	if err := term.PrintOutput(cmd); err != nil {
+		return ErrImageBuild
+	}
 
-		dockerBuildArgs[i*2] = "--build-arg"
-		dockerBuildArgs[i*2+1] = v
+	return nil
+}
 
-	}
+// BuildxBuild builds an image with docker buildx and pushes it with all its tags. An image
+// built for several opts.Platforms is pushed as a manifest list. Images in
+// opts.CacheFrom are read as registry cache without pulling them, and the pushed image
+// carries inline cache metadata.
+func BuildxBuild(opts *BuildOptions) error {
+	dockerCmdArgs := buildxBuildArgs(opts)
 
-	dockerCmd := "docker"
-	dockerCmdArgs := []string{"build", "-f", dockerfile, "-t", image, "."}
-	dockerCmdBuildArgs := append([]string(dockerConfigBuildArgs), []string(dockerBuildArgs)...)
-	dockerCmdFullArgs := append([]string(dockerCmdArgs), []string(dockerCmdBuildArgs)...)
+	cmd := exec.Command("docker", dockerCmdArgs...)
+	cmd.Dir = opts.Dir
 
-	cmd := exec.Command(dockerCmd, dockerCmdFullArgs...)
+	echo(dockerCmdArgs)
 
-	if err := term.PrintStdout(cmd); err != nil {
+	// buildx writes its progress to stderr
+	if err := term.PrintOutput(cmd); err != nil {
 		return ErrImageBuild
 	}
 
 	return nil
 }
 
+// imageBuildArgs returns the arguments of the docker build command of ImageBuild
+func imageBuildArgs(opts *BuildOptions) []string {
+	args := append([]string{"build"}, buildFlags(opts)...)
+
+	for _, image := range opts.CacheFrom {
+		args = append(args, "--cache-from", image)
+	}
+
+	if len(opts.CacheFrom) > 0 {
+		args = append(args, "--build-arg", "BUILDKIT_INLINE_CACHE=1")
+	}
+
+	return append(args, opts.buildContext())
+}
+
+// buildxBuildArgs returns the arguments of the docker buildx build command of BuildxBuild
+func buildxBuildArgs(opts *BuildOptions) []string {
+	args := append([]string{"buildx", "build", "--push"}, buildFlags(opts)...)
+
+	for _, image := range opts.CacheFrom {
+		args = append(args, "--cache-from", "type=registry,ref="+image)
+	}
+
+	if len(opts.CacheFrom) > 0 {
+		args = append(args, "--cache-to", "type=inline")
+	}
+
+	return append(args, opts.buildContext())
+}
+
+// echo prints a docker command before it runs, masked values are hidden by term.Output
+func echo(args []string) {
+	fmt.Fprintf(term.Output, "$ docker %s\n", strings.Join(args, " "))
+}
+
+// buildFlags returns the dockerfile, tag, build arg, target, label, secret and ssh flags
+// of a build
+func buildFlags(opts *BuildOptions) []string {
+	flags := []string{"-f", opts.Dockerfile, "-t", fmt.Sprintf("%s:%s", opts.Repo, opts.Tag)}
+
+	for _, tag := range opts.Tags {
+		flags = append(flags, "-t", fmt.Sprintf("%s:%s", opts.Repo, tag))
+	}
+
+	if len(opts.Platforms) > 0 {
+		flags = append(flags, "--platform", strings.Join(opts.Platforms, ","))
+	}
+
+	for _, arg := range opts.ConfigBuildArgs {
+		flags = append(flags, "--build-arg", arg)
+	}
+
+	for _, arg := range opts.BuildArgs {
+		flags = append(flags, "--build-arg", arg)
+	}
+
+	if opts.Target != "" {
+		flags = append(flags, "--target", opts.Target)
+	}
+
+	for _, label := range opts.Labels {
+		flags = append(flags, "--label", label)
+	}
+
+	for _, secret := range opts.Secrets {
+		flags = append(flags, "--secret", secret)
+	}
+
+	for _, ssh := range opts.SSH {
+		flags = append(flags, "--ssh", ssh)
+	}
+
+	return flags
+}
+
 // ImagePush pushes the image built from buildImage to the configured repository
 func ImagePush(repo string, tag string) error {
 	image := fmt.Sprintf("%s:%s", repo, tag)
@@ -55,3 +176,14 @@ func ImagePush(repo string, tag string) error {
 
 	return nil
 }
+
+// ImagePull pulls an image from its repository
+func ImagePull(image string) error {
+	cmd := exec.Command("docker", "pull", image)
+
+	if err := term.PrintStdout(cmd); err != nil {
+		return ErrImagePull
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImageBuildArgs(t *testing.T) {
+	cases := []struct {
+		Opts     *BuildOptions
+		Expected string
+	}{
+		{
+			Opts:     &BuildOptions{Repo: "repo", Tag: "a1b2c3d", Dockerfile: "Dockerfile"},
+			Expected: "build -f Dockerfile -t repo:a1b2c3d .",
+		},
+		{
+			Opts: &BuildOptions{
+				Repo:            "repo",
+				Tag:             "a1b2c3d",
+				Tags:            []string{"main"},
+				Dockerfile:      "docker/Dockerfile",
+				ConfigBuildArgs: []string{"ENV=dev"},
+				BuildArgs:       []string{"VERSION=1"},
+				Context:         "app",
+				Target:          "release",
+				Labels:          []string{"team=api", "tier=web"},
+			},
+			Expected: "build -f docker/Dockerfile -t repo:a1b2c3d -t repo:main --build-arg ENV=dev --build-arg VERSION=1 --target release --label team=api --label tier=web app",
+		},
+		{
+			Opts: &BuildOptions{
+				Repo:       "repo",
+				Tag:        "a1b2c3d",
+				Dockerfile: "Dockerfile",
+				Secrets:    []string{"id=npm,src=.npmrc"},
+				SSH:        []string{"default"},
+				CacheFrom:  []string{"repo:main"},
+			},
+			Expected: "build -f Dockerfile -t repo:a1b2c3d --secret id=npm,src=.npmrc --ssh default --cache-from repo:main --build-arg BUILDKIT_INLINE_CACHE=1 .",
+		},
+	}
+
+	for i, c := range cases {
+		if a, e := strings.Join(imageBuildArgs(c.Opts), " "), c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
+
+func TestBuildxBuildArgs(t *testing.T) {
+	cases := []struct {
+		Opts     *BuildOptions
+		Expected string
+	}{
+		{
+			Opts:     &BuildOptions{Repo: "repo", Tag: "a1b2c3d", Dockerfile: "Dockerfile", Platforms: []string{"linux/amd64", "linux/arm64"}},
+			Expected: "buildx build --push -f Dockerfile -t repo:a1b2c3d --platform linux/amd64,linux/arm64 .",
+		},
+		{
+			Opts: &BuildOptions{
+				Repo:       "repo",
+				Tag:        "a1b2c3d",
+				Tags:       []string{"main"},
+				Dockerfile: "app/Dockerfile",
+				Context:    "app",
+				Target:     "release",
+				Labels:     []string{"team=api"},
+				Secrets:    []string{"id=npm,env=NPM_TOKEN"},
+				SSH:        []string{"default=/tmp/agent.sock"},
+				CacheFrom:  []string{"repo:main", "repo:latest"},
+			},
+			Expected: "buildx build --push -f app/Dockerfile -t repo:a1b2c3d -t repo:main --target release --label team=api --secret id=npm,env=NPM_TOKEN --ssh default=/tmp/agent.sock --cache-from type=registry,ref=repo:main --cache-from type=registry,ref=repo:latest --cache-to type=inline app",
+		},
+	}
+
+	for i, c := range cases {
+		if a, e := strings.Join(buildxBuildArgs(c.Opts), " "), c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
+
+func TestNeedsBuildKit(t *testing.T) {
+	cases := []struct {
+		Opts     *BuildOptions
+		Expected bool
+	}{
+		{Opts: &BuildOptions{Target: "release", Labels: []string{"team=api"}, Context: "app"}, Expected: false},
+		{Opts: &BuildOptions{CacheFrom: []string{"repo:main"}}, Expected: true},
+		{Opts: &BuildOptions{Secrets: []string{"id=npm,src=.npmrc"}}, Expected: true},
+		{Opts: &BuildOptions{SSH: []string{"default"}}, Expected: true},
+	}
+
+	for i, c := range cases {
+		if a, e := c.Opts.needsBuildKit(), c.Expected; a != e {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
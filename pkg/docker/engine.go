@@ -0,0 +1,479 @@
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// defaultSocket is the Docker Engine API socket used when DOCKER_HOST is not a unix socket
+const defaultSocket = "/var/run/docker.sock"
+
+// AuthConfig is the registry login sent with the pulls and pushes of the Docker Engine API
+type AuthConfig struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ServerAddress string `json:"serveraddress"`
+}
+
+// BuildError is returned when the Docker Engine reports an error during a build. Step is
+// the last build step that was started, e.g. "Step 4/9 : RUN npm ci".
+type BuildError struct {
+	Step    string
+	Message string
+}
+
+func (e *BuildError) Error() string {
+	if e.Step == "" {
+		return fmt.Sprintf("%s: %s", ErrImageBuild, e.Message)
+	}
+
+	return fmt.Sprintf("%s at %s: %s", ErrImageBuild, e.Step, e.Message)
+}
+
+// Unwrap makes a BuildError match ErrImageBuild
+func (e *BuildError) Unwrap() error {
+	return ErrImageBuild
+}
+
+// Engine builds and pushes images through the Docker Engine API instead of running the
+// docker binary, so the progress and errors of a build can be read
+type Engine struct {
+	client *http.Client
+}
+
+// jsonMessage is a line of the progress stream of a build, pull or push
+type jsonMessage struct {
+	Stream      string `json:"stream"`
+	Status      string `json:"status"`
+	Progress    string `json:"progress"`
+	ID          string `json:"id"`
+	Error       string `json:"error"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+	Aux json.RawMessage `json:"aux"`
+}
+
+func (m *jsonMessage) err() string {
+	if m.ErrorDetail != nil && m.ErrorDetail.Message != "" {
+		return m.ErrorDetail.Message
+	}
+
+	return m.Error
+}
+
+// NewEngine returns an Engine for the unix socket of DOCKER_HOST, or /var/run/docker.sock
+func NewEngine() *Engine {
+	socket := defaultSocket
+
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		socket = strings.TrimPrefix(host, "unix://")
+	}
+
+	dialer := &net.Dialer{}
+
+	return &Engine{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// ImageBuild builds an image like ImageBuild does with the docker binary. The build context
+// is sent as a tar of the context directory without the files matched by its .dockerignore,
+// so the dockerfile has to be inside the context. The build output is printed as it is
+// streamed, a failed build returns a BuildError. The engine runs the classic builder, which
+// has no secrets or ssh forwarding.
+func (e *Engine) ImageBuild(ctx context.Context, opts *BuildOptions) error {
+	if len(opts.Secrets) > 0 || len(opts.SSH) > 0 {
+		return ErrEngineBuildKit
+	}
+
+	dir := filepath.Join(opts.Dir, opts.buildContext())
+
+	dockerfile, err := filepath.Rel(dir, filepath.Join(opts.Dir, opts.Dockerfile))
+	if err != nil || strings.HasPrefix(filepath.ToSlash(dockerfile), "../") {
+		return ErrDockerfileOutsideContext
+	}
+
+	query := url.Values{}
+	query.Set("dockerfile", filepath.ToSlash(dockerfile))
+	query.Add("t", fmt.Sprintf("%s:%s", opts.Repo, opts.Tag))
+
+	for _, tag := range opts.Tags {
+		query.Add("t", fmt.Sprintf("%s:%s", opts.Repo, tag))
+	}
+
+	buildArgs, err := json.Marshal(buildArgMap(append(append([]string{}, opts.ConfigBuildArgs...), opts.BuildArgs...)))
+	if err != nil {
+		return err
+	}
+
+	query.Set("buildargs", string(buildArgs))
+
+	if len(opts.Platforms) > 0 {
+		query.Set("platform", strings.Join(opts.Platforms, ","))
+	}
+
+	if opts.Target != "" {
+		query.Set("target", opts.Target)
+	}
+
+	if len(opts.Labels) > 0 {
+		labels, err := json.Marshal(labelMap(opts.Labels))
+		if err != nil {
+			return err
+		}
+
+		query.Set("labels", string(labels))
+	}
+
+	if len(opts.CacheFrom) > 0 {
+		cacheFrom, err := json.Marshal(opts.CacheFrom)
+		if err != nil {
+			return err
+		}
+
+		query.Set("cachefrom", string(cacheFrom))
+	}
+
+	body, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(tarContext(dir, dockerfile, writer))
+	}()
+
+	defer body.Close()
+
+	res, err := e.post(ctx, "/build?"+query.Encode(), "application/x-tar", body, nil)
+	if err != nil {
+		return &BuildError{Message: err.Error()}
+	}
+
+	defer res.Body.Close()
+
+	step := ""
+
+	return readMessages(res.Body, func(m *jsonMessage) error {
+		if msg := m.err(); msg != "" {
+			return &BuildError{Step: step, Message: msg}
+		}
+
+		if m.Stream != "" {
+			fmt.Fprint(term.Output, m.Stream)
+
+			if strings.HasPrefix(m.Stream, "Step ") {
+				step = strings.TrimSpace(m.Stream)
+			}
+		}
+
+		return nil
+	})
+}
+
+// ImagePull pulls an image with the given registry login
+func (e *Engine) ImagePull(ctx context.Context, image string, auth *AuthConfig) error {
+	repo, tag := splitImage(image)
+
+	query := url.Values{}
+	query.Set("fromImage", repo)
+	query.Set("tag", tag)
+
+	res, err := e.post(ctx, "/images/create?"+query.Encode(), "", nil, auth)
+	if err != nil {
+		return fmt.Errorf("%s: %s", ErrImagePull, err)
+	}
+
+	defer res.Body.Close()
+
+	return readMessages(res.Body, func(m *jsonMessage) error {
+		if msg := m.err(); msg != "" {
+			return fmt.Errorf("%s: %s", ErrImagePull, msg)
+		}
+
+		return nil
+	})
+}
+
+// ImagePush pushes an image tag with the given registry login and returns the digest of the
+// pushed image
+func (e *Engine) ImagePush(ctx context.Context, repo string, tag string, auth *AuthConfig) (string, error) {
+	query := url.Values{}
+	query.Set("tag", tag)
+
+	res, err := e.post(ctx, fmt.Sprintf("/images/%s/push?%s", repo, query.Encode()), "", nil, auth)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", ErrEnginePush, err)
+	}
+
+	defer res.Body.Close()
+
+	digest := ""
+
+	err = readMessages(res.Body, func(m *jsonMessage) error {
+		if msg := m.err(); msg != "" {
+			return fmt.Errorf("%s: %s", ErrEnginePush, msg)
+		}
+
+		// Progress bars are left out, only the result of each layer is printed
+		if m.Status != "" && m.Progress == "" {
+			if m.ID != "" {
+				fmt.Fprintf(term.Output, "%s: %s\n", m.ID, m.Status)
+			} else {
+				fmt.Fprintln(term.Output, m.Status)
+			}
+		}
+
+		if len(m.Aux) > 0 {
+			aux := struct {
+				Digest string `json:"Digest"`
+			}{}
+
+			if err := json.Unmarshal(m.Aux, &aux); err == nil && aux.Digest != "" {
+				digest = aux.Digest
+			}
+		}
+
+		return nil
+	})
+
+	return digest, err
+}
+
+// post sends a request to the Docker Engine API and returns the response when its status is
+// 200, otherwise the error message of the response
+func (e *Engine) post(ctx context.Context, path string, contentType string, body io.Reader, auth *AuthConfig) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, "http://docker"+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if auth != nil {
+		encoded, err := json.Marshal(auth)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("X-Registry-Auth", base64.URLEncoding.EncodeToString(encoded))
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrEngineConnect, err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+
+		message := struct {
+			Message string `json:"message"`
+		}{}
+
+		b, _ := ioutil.ReadAll(res.Body)
+		if err := json.Unmarshal(b, &message); err != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(b))
+		}
+
+		return nil, fmt.Errorf("%s: %s", res.Status, message.Message)
+	}
+
+	return res, nil
+}
+
+// readMessages calls fn with every message of a progress stream until fn returns an error
+func readMessages(r io.Reader, fn func(m *jsonMessage) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	for {
+		m := &jsonMessage{}
+
+		if err := dec.Decode(m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+}
+
+// buildArgMap turns key=value build args into the map of the build API. A key without a
+// value takes the value of the environment variable, like docker build --build-arg does.
+func buildArgMap(args []string) map[string]*string {
+	m := map[string]*string{}
+
+	for _, arg := range args {
+		split := strings.SplitN(arg, "=", 2)
+
+		if len(split) == 2 {
+			m[split[0]] = &split[1]
+			continue
+		}
+
+		if value, ok := os.LookupEnv(split[0]); ok {
+			m[split[0]] = &value
+		}
+	}
+
+	return m
+}
+
+// labelMap turns key=value labels into the map of the build API, a label without a value
+// is empty
+func labelMap(labels []string) map[string]string {
+	m := map[string]string{}
+
+	for _, label := range labels {
+		split := strings.SplitN(label, "=", 2)
+
+		if len(split) == 2 {
+			m[split[0]] = split[1]
+		} else {
+			m[split[0]] = ""
+		}
+	}
+
+	return m
+}
+
+// splitImage splits an image into its repo and tag, the tag is latest when the image has none
+func splitImage(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+
+	return image[:i], image[i+1:]
+}
+
+// tarContext writes the files of a build context directory to w as a tar archive, leaving
+// out the files matched by the .dockerignore of the directory. The dockerfile and the
+// .dockerignore are always sent.
+func tarContext(dir string, dockerfile string, w io.Writer) error {
+	ignore, err := readDockerignore(dir)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{".dockerignore": true, filepath.ToSlash(filepath.Clean(dockerfile)): true}
+
+	tw := tar.NewWriter(w)
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		ignored, err := ignore.MatchesOrParentMatches(rel)
+		if err != nil {
+			return err
+		}
+
+		if !keep[rel] && ignored {
+			if info.IsDir() && !ignore.Exclusions() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		header.Name = rel
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// readDockerignore returns the patterns of the .dockerignore of a build context directory.
+// They are matched the way docker build matches them, so ** matches any number of
+// directories and a pattern starting with ! re-includes the files it matches.
+func readDockerignore(dir string) (*patternmatcher.PatternMatcher, error) {
+	f, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return patternmatcher.New(nil)
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	patterns, err := ignorefile.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return patternmatcher.New(patterns)
+}
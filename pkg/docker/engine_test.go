@@ -0,0 +1,467 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+)
+
+// testEngine returns an Engine that sends its requests to a test server
+func testEngine(handler http.HandlerFunc) (*Engine, func()) {
+	server := httptest.NewServer(handler)
+	dialer := &net.Dialer{}
+
+	return &Engine{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "tcp", server.Listener.Addr().String())
+				},
+			},
+		},
+	}, server.Close
+}
+
+// quiet discards term.Output, the returned function restores it
+func quiet() func() {
+	output := term.Output
+	term.Output = ioutil.Discard
+
+	return func() { term.Output = output }
+}
+
+func TestTarContext(t *testing.T) {
+	files := []string{
+		".env",
+		"Dockerfile",
+		"main.go",
+		"a/b/.env",
+		"a/b/main.go",
+		"node_modules/x/index.js",
+		"web/node_modules/y/index.js",
+		"web/app.js",
+		"logs/a.log",
+		"logs/keep.log",
+	}
+
+	cases := []struct {
+		Dockerignore string
+		Expected     []string
+	}{
+		{
+			Dockerignore: "",
+			Expected:     files,
+		},
+		{
+			Dockerignore: "**/.env\n**/node_modules\n",
+			Expected:     []string{"Dockerfile", "main.go", "a/b/main.go", "web/app.js", "logs/a.log", "logs/keep.log"},
+		},
+		{
+			Dockerignore: "# comment\n/.env\nlogs\n!logs/keep.log\n",
+			Expected:     []string{"Dockerfile", "main.go", "a/b/.env", "a/b/main.go", "node_modules/x/index.js", "web/node_modules/y/index.js", "web/app.js", "logs/keep.log"},
+		},
+		{
+			Dockerignore: "*\n",
+			Expected:     []string{"Dockerfile"},
+		},
+	}
+
+	for i, c := range cases {
+		dir, err := ioutil.TempDir("", "ufo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.RemoveAll(dir)
+
+		for _, file := range files {
+			path := filepath.Join(dir, filepath.FromSlash(file))
+
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if c.Dockerignore != "" {
+			if err := ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(c.Dockerignore), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var buf bytes.Buffer
+
+		if err := tarContext(dir, "Dockerfile", &buf); err != nil {
+			t.Errorf("%d, expected no error, got %s", i, err)
+			continue
+		}
+
+		sent := []string{}
+		tr := tar.NewReader(&buf)
+
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if header.Typeflag == tar.TypeReg && header.Name != ".dockerignore" {
+				sent = append(sent, header.Name)
+			}
+		}
+
+		expected := append([]string{}, c.Expected...)
+		sort.Strings(sent)
+		sort.Strings(expected)
+
+		if a, e := sent, expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected files %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestReadMessages(t *testing.T) {
+	stop := errors.New("stop")
+
+	cases := []struct {
+		Stream   string
+		Expected []string
+		Error    string
+	}{
+		{
+			Stream:   `{"stream":"Step 1/2 : FROM alpine"}{"stream":"Step 2/2 : RUN true"}`,
+			Expected: []string{"Step 1/2 : FROM alpine", "Step 2/2 : RUN true"},
+		},
+		{
+			Stream:   "{\"status\":\"a\"}\n{\"status\":\"b\"}\n",
+			Expected: []string{"a", "b"},
+		},
+		{
+			Stream:   `{"stream":"Step 1/2 : FROM alpine"}{"stream":`,
+			Expected: []string{"Step 1/2 : FROM alpine"},
+			Error:    "unexpected EOF",
+		},
+		{
+			Stream:   `{"stream":"a"}{"stream":"stop"}{"stream":"b"}`,
+			Expected: []string{"a", "stop"},
+			Error:    stop.Error(),
+		},
+	}
+
+	for i, c := range cases {
+		read := []string{}
+
+		err := readMessages(strings.NewReader(c.Stream), func(m *jsonMessage) error {
+			read = append(read, m.Stream+m.Status)
+
+			if m.Stream == "stop" {
+				return stop
+			}
+
+			return nil
+		})
+
+		if a, e := read, c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected messages %v, got %v", i, e, a)
+		}
+
+		if c.Error == "" && err != nil {
+			t.Errorf("%d, expected no error, got %s", i, err)
+		} else if c.Error != "" && (err == nil || err.Error() != c.Error) {
+			t.Errorf("%d, expected error %s, got %v", i, c.Error, err)
+		}
+	}
+}
+
+func TestEngineImageBuild(t *testing.T) {
+	cases := []struct {
+		Stream   string
+		Expected string
+	}{
+		{
+			Stream:   `{"stream":"Step 1/1 : FROM alpine\n"}{"stream":"Successfully built 1234\n"}`,
+			Expected: "",
+		},
+		{
+			Stream:   `{"stream":"Step 1/2 : FROM alpine\n"}{"stream":"Step 2/2 : RUN false\n"}{"errorDetail":{"message":"returned a non-zero code: 1"},"error":"returned a non-zero code: 1"}`,
+			Expected: ErrImageBuild.Error() + " at Step 2/2 : RUN false: returned a non-zero code: 1",
+		},
+		{
+			Stream:   `{"error":"no space left on device"}`,
+			Expected: ErrImageBuild.Error() + ": no space left on device",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "ufo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	restore := quiet()
+	defer restore()
+
+	for i, c := range cases {
+		engine, stop := testEngine(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(ioutil.Discard, r.Body)
+			io.WriteString(w, c.Stream)
+		})
+
+		err := engine.ImageBuild(context.Background(), &BuildOptions{
+			Repo:       "repo",
+			Tag:        "tag",
+			Dockerfile: "Dockerfile",
+			Dir:        dir,
+		})
+
+		stop()
+
+		if c.Expected == "" {
+			if err != nil {
+				t.Errorf("%d, expected no error, got %s", i, err)
+			}
+
+			continue
+		}
+
+		if err == nil || err.Error() != c.Expected {
+			t.Errorf("%d, expected error %s, got %v", i, c.Expected, err)
+		}
+
+		if _, ok := err.(*BuildError); !ok {
+			t.Errorf("%d, expected a BuildError, got %T", i, err)
+		}
+	}
+}
+
+func TestEngineImageBuildQuery(t *testing.T) {
+	cases := []struct {
+		Opts     *BuildOptions
+		Expected url.Values
+		Error    error
+	}{
+		{
+			Opts: &BuildOptions{Repo: "repo", Tag: "a1b2c3d", Dockerfile: "Dockerfile"},
+			Expected: url.Values{
+				"dockerfile": {"Dockerfile"},
+				"t":          {"repo:a1b2c3d"},
+				"buildargs":  {"{}"},
+			},
+		},
+		{
+			Opts: &BuildOptions{
+				Repo:            "repo",
+				Tag:             "a1b2c3d",
+				Tags:            []string{"main"},
+				Dockerfile:      "app/docker/Dockerfile",
+				ConfigBuildArgs: []string{"ENV=dev"},
+				BuildArgs:       []string{"VERSION=1"},
+				Platforms:       []string{"linux/arm64"},
+				Context:         "app",
+				Target:          "release",
+				Labels:          []string{"team=api", "tier"},
+				CacheFrom:       []string{"repo:main"},
+			},
+			Expected: url.Values{
+				"dockerfile": {"docker/Dockerfile"},
+				"t":          {"repo:a1b2c3d", "repo:main"},
+				"buildargs":  {`{"ENV":"dev","VERSION":"1"}`},
+				"platform":   {"linux/arm64"},
+				"target":     {"release"},
+				"labels":     {`{"team":"api","tier":""}`},
+				"cachefrom":  {`["repo:main"]`},
+			},
+		},
+		{
+			Opts:  &BuildOptions{Repo: "repo", Tag: "a1b2c3d", Dockerfile: "Dockerfile", Context: "app"},
+			Error: ErrDockerfileOutsideContext,
+		},
+		{
+			Opts:  &BuildOptions{Repo: "repo", Tag: "a1b2c3d", Dockerfile: "Dockerfile", Secrets: []string{"id=npm,src=.npmrc"}},
+			Error: ErrEngineBuildKit,
+		},
+		{
+			Opts:  &BuildOptions{Repo: "repo", Tag: "a1b2c3d", Dockerfile: "Dockerfile", SSH: []string{"default"}},
+			Error: ErrEngineBuildKit,
+		},
+	}
+
+	restore := quiet()
+	defer restore()
+
+	for i, c := range cases {
+		dir, err := ioutil.TempDir("", "ufo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.RemoveAll(dir)
+
+		for _, file := range []string{"Dockerfile", "app/docker/Dockerfile"} {
+			path := filepath.Join(dir, filepath.FromSlash(file))
+
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ioutil.WriteFile(path, []byte("FROM alpine\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var query url.Values
+
+		engine, stop := testEngine(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			io.Copy(ioutil.Discard, r.Body)
+			io.WriteString(w, `{"stream":"Successfully built 1234\n"}`)
+		})
+
+		c.Opts.Dir = dir
+		err = engine.ImageBuild(context.Background(), c.Opts)
+
+		stop()
+
+		if a, e := err, c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, a)
+		}
+
+		if c.Error != nil {
+			if query != nil {
+				t.Errorf("%d, expected no build to be sent, got %v", i, query)
+			}
+
+			continue
+		}
+
+		if a, e := query, c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected query %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestEngineImagePush(t *testing.T) {
+	cases := []struct {
+		Status         int
+		Stream         string
+		ExpectedDigest string
+		ExpectedError  string
+	}{
+		{
+			Status:         http.StatusOK,
+			Stream:         `{"status":"Pushed","id":"abc"}{"status":"tag: digest: sha256:1234 size: 528"}{"aux":{"Tag":"tag","Digest":"sha256:1234","Size":528}}`,
+			ExpectedDigest: "sha256:1234",
+		},
+		{
+			Status:         http.StatusOK,
+			Stream:         `{"status":"Pushed","id":"abc"}{"aux":{"Tag":"tag"}}`,
+			ExpectedDigest: "",
+		},
+		{
+			Status:        http.StatusOK,
+			Stream:        `{"status":"Preparing","id":"abc"}{"errorDetail":{"message":"denied"},"error":"denied"}`,
+			ExpectedError: ErrEnginePush.Error() + ": denied",
+		},
+		{
+			Status:        http.StatusNotFound,
+			Stream:        `{"message":"No such image: repo:tag"}`,
+			ExpectedError: ErrEnginePush.Error() + ": 404 Not Found: No such image: repo:tag",
+		},
+	}
+
+	restore := quiet()
+	defer restore()
+
+	for i, c := range cases {
+		var auth string
+
+		engine, stop := testEngine(func(w http.ResponseWriter, r *http.Request) {
+			auth = r.Header.Get("X-Registry-Auth")
+			w.WriteHeader(c.Status)
+			io.WriteString(w, c.Stream)
+		})
+
+		digest, err := engine.ImagePush(context.Background(), "repo", "tag", &AuthConfig{Username: "AWS"})
+
+		stop()
+
+		if auth == "" {
+			t.Errorf("%d, expected the registry login to be sent", i)
+		}
+
+		if a, e := digest, c.ExpectedDigest; a != e {
+			t.Errorf("%d, expected digest %s, got %s", i, e, a)
+		}
+
+		if c.ExpectedError == "" && err != nil {
+			t.Errorf("%d, expected no error, got %s", i, err)
+		} else if c.ExpectedError != "" && (err == nil || err.Error() != c.ExpectedError) {
+			t.Errorf("%d, expected error %s, got %v", i, c.ExpectedError, err)
+		}
+	}
+}
+
+func TestBuildArgMap(t *testing.T) {
+	os.Setenv("UFO_TEST_BUILD_ARG", "from-env")
+	defer os.Unsetenv("UFO_TEST_BUILD_ARG")
+
+	m := buildArgMap([]string{"A=1", "B=x=y", "C=", "UFO_TEST_BUILD_ARG", "UFO_TEST_UNSET_BUILD_ARG"})
+
+	expected := map[string]string{"A": "1", "B": "x=y", "C": "", "UFO_TEST_BUILD_ARG": "from-env"}
+
+	if a, e := len(m), len(expected); a != e {
+		t.Errorf("expected %d build args, got %d", e, a)
+	}
+
+	for key, value := range expected {
+		if m[key] == nil || *m[key] != value {
+			t.Errorf("expected build arg %s to be %q, got %v", key, value, m[key])
+		}
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	cases := []struct {
+		Image string
+		Repo  string
+		Tag   string
+	}{
+		{Image: "alpine", Repo: "alpine", Tag: "latest"},
+		{Image: "alpine:3.12", Repo: "alpine", Tag: "3.12"},
+		{Image: "localhost:5000/app", Repo: "localhost:5000/app", Tag: "latest"},
+		{Image: "localhost:5000/app:v1", Repo: "localhost:5000/app", Tag: "v1"},
+	}
+
+	for i, c := range cases {
+		repo, tag := splitImage(c.Image)
+
+		if repo != c.Repo || tag != c.Tag {
+			t.Errorf("%d, expected %s %s, got %s %s", i, c.Repo, c.Tag, repo, tag)
+		}
+	}
+}
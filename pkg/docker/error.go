@@ -3,6 +3,11 @@ package docker
 import "errors"
 
 var (
-	ErrImageBuild = errors.New("Could not build docker image")
-	ErrImagePush  = errors.New("Could not push docker image. Are you logged in to ECR? http://docs.aws.amazon.com/AmazonECR/latest/userguide/Registries.html#registry_auth\nHint: `$(aws ecr get-login --no-include-email --region us-west-1)`\nDon't forget your --profile if you use one")
+	ErrImageBuild               = errors.New("Could not build docker image")
+	ErrImagePull                = errors.New("Could not pull docker image")
+	ErrEnginePush               = errors.New("Could not push docker image")
+	ErrEngineConnect            = errors.New("Could not connect to the Docker Engine socket")
+	ErrEngineBuildKit           = errors.New("The engine builder does not support build secrets or ssh forwarding, use the docker or buildx builder")
+	ErrDockerfileOutsideContext = errors.New("The dockerfile has to be inside the build context for the engine builder")
+	ErrImagePush                = errors.New("Could not push docker image. Are you logged in to ECR? http://docs.aws.amazon.com/AmazonECR/latest/userguide/Registries.html#registry_auth\nHint: `$(aws ecr get-login --no-include-email --region us-west-1)`\nDon't forget your --profile if you use one")
 )
@@ -5,5 +5,7 @@ import (
 )
 
 var (
-	ErrGitError = errors.New("Could not read git information. Please make sure you have git installed and are in a git repository")
+	ErrGitError    = errors.New("Could not read git information. Please make sure you have git installed and are in a git repository")
+	ErrRefNotFound = errors.New("Could not resolve the git ref to a commit")
+	ErrWorktree    = errors.New("Could not create or remove a temporary git worktree")
 )
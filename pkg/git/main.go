@@ -1,6 +1,8 @@
 package git
 
 import (
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -30,3 +32,111 @@ func GetBranch() (string, error) {
 
 	return strings.Trim(string(r), "\n"), nil
 }
+
+// GetUser returns the email of the configured git user
+func GetUser() (string, error) {
+	cmd := exec.Command("git", "config", "user.email")
+
+	r, err := cmd.Output()
+
+	if err != nil {
+		return "", ErrGitError
+	}
+
+	return strings.Trim(string(r), "\n"), nil
+}
+
+// IsDirty reports whether the working tree has uncommitted or untracked changes
+func IsDirty() (bool, error) {
+	cmd := exec.Command("git", "status", "--porcelain")
+
+	r, err := cmd.Output()
+
+	if err != nil {
+		return false, ErrGitError
+	}
+
+	return strings.TrimSpace(string(r)) != "", nil
+}
+
+// ResolveRef returns the short commit hash a tag, branch or sha points to
+func ResolveRef(ref string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "--short", ref+"^{commit}")
+
+	r, err := cmd.Output()
+
+	if err != nil {
+		return "", ErrRefNotFound
+	}
+
+	return strings.Trim(string(r), "\n"), nil
+}
+
+// GetFullCommit returns the full commit hash a tag, branch or sha points to
+func GetFullCommit(ref string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+
+	r, err := cmd.Output()
+
+	if err != nil {
+		return "", ErrRefNotFound
+	}
+
+	return strings.Trim(string(r), "\n"), nil
+}
+
+// Describe returns the most recent tag reachable from a ref as described by git describe,
+// e.g. v1.4.0 or v1.4.0-3-ga1b2c3d. It falls back to the short commit hash when there are no tags.
+func Describe(ref string) (string, error) {
+	cmd := exec.Command("git", "describe", "--tags", "--always", ref)
+
+	r, err := cmd.Output()
+
+	if err != nil {
+		return "", ErrGitError
+	}
+
+	return strings.Trim(string(r), "\n"), nil
+}
+
+// GetPrefix returns the path of the current directory relative to the root of a git repo
+func GetPrefix() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--show-prefix")
+
+	r, err := cmd.Output()
+
+	if err != nil {
+		return "", ErrGitError
+	}
+
+	return strings.Trim(string(r), "\n"), nil
+}
+
+// AddWorktree checks out a commit into a new temporary worktree and returns its path
+func AddWorktree(commit string) (string, error) {
+	dir, err := ioutil.TempDir("", "ufo-")
+
+	if err != nil {
+		return "", ErrWorktree
+	}
+
+	cmd := exec.Command("git", "worktree", "add", "--detach", dir, commit)
+
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return "", ErrWorktree
+	}
+
+	return dir, nil
+}
+
+// RemoveWorktree removes a worktree created by AddWorktree
+func RemoveWorktree(dir string) error {
+	cmd := exec.Command("git", "worktree", "remove", "--force", dir)
+
+	if err := cmd.Run(); err != nil {
+		return ErrWorktree
+	}
+
+	return nil
+}
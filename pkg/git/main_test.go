@@ -0,0 +1,190 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRepo creates a git repo with two commits, a tag on the first and a branch on the second,
+// and changes into it. The returned function changes back and removes the repo.
+func testRepo(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "ufo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup := func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+
+	commands := [][]string{
+		{"init", "-q"},
+		{"checkout", "-q", "-b", "main"},
+		{"add", "README"},
+		{"commit", "-q", "-m", "first"},
+		{"tag", "v1.0.0"},
+		{"add", "main.go"},
+		{"commit", "-q", "-m", "second"},
+		{"branch", "feature"},
+	}
+
+	for _, file := range []string{"README", "main.go"} {
+		if err := ioutil.WriteFile(file, []byte("test\n"), 0644); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+
+	for _, args := range commands {
+		gitArgs := append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)
+
+		if out, err := exec.Command("git", gitArgs...).CombinedOutput(); err != nil {
+			cleanup()
+			t.Fatalf("git %s: %s", strings.Join(args, " "), out)
+		}
+	}
+
+	return cleanup
+}
+
+// revParse returns the short hash of a ref in the current repo
+func revParse(t *testing.T, ref string) string {
+	out, err := exec.Command("git", "rev-parse", "--short", ref).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+func TestResolveRef(t *testing.T) {
+	cleanup := testRepo(t)
+	defer cleanup()
+
+	first, second := revParse(t, "HEAD~1"), revParse(t, "HEAD")
+	full, err := GetFullCommit("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Ref      string
+		Expected string
+		Error    error
+	}{
+		{Ref: "v1.0.0", Expected: first},
+		{Ref: "feature", Expected: second},
+		{Ref: "main", Expected: second},
+		{Ref: full, Expected: second},
+		{Ref: first, Expected: first},
+		{Ref: "does-not-exist", Error: ErrRefNotFound},
+	}
+
+	for i, c := range cases {
+		commit, err := ResolveRef(c.Ref)
+
+		if a, e := err, c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, a)
+		}
+
+		if a, e := commit, c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
+
+func TestWorktree(t *testing.T) {
+	cleanup := testRepo(t)
+	defer cleanup()
+
+	dir, err := AddWorktree("v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "README")); err != nil {
+		t.Errorf("expected the worktree to have the files of the commit, got %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "main.go")); !os.IsNotExist(err) {
+		t.Errorf("expected the worktree to not have files of later commits")
+	}
+
+	if err := RemoveWorktree(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the worktree directory to be removed")
+	}
+
+	out, err := exec.Command("git", "worktree", "list", "--porcelain").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(out), dir) {
+		t.Errorf("expected the worktree to be unregistered, got %s", out)
+	}
+
+	if _, err := AddWorktree("does-not-exist"); err != ErrWorktree {
+		t.Errorf("expected error %v, got %v", ErrWorktree, err)
+	}
+}
+
+func TestIsDirty(t *testing.T) {
+	cleanup := testRepo(t)
+	defer cleanup()
+
+	cases := []struct {
+		Change   func() error
+		Expected bool
+	}{
+		{
+			Change:   func() error { return nil },
+			Expected: false,
+		},
+		{
+			Change:   func() error { return ioutil.WriteFile("README", []byte("changed\n"), 0644) },
+			Expected: true,
+		},
+		{
+			Change:   func() error { return exec.Command("git", "checkout", "-q", "--", "README").Run() },
+			Expected: false,
+		},
+		{
+			Change:   func() error { return ioutil.WriteFile("untracked.go", []byte("test\n"), 0644) },
+			Expected: true,
+		},
+	}
+
+	for i, c := range cases {
+		if err := c.Change(); err != nil {
+			t.Fatal(err)
+		}
+
+		dirty, err := IsDirty()
+
+		if err != nil {
+			t.Fatalf("%d, expected no error, got %s", i, err)
+		}
+
+		if a, e := dirty, c.Expected; a != e {
+			t.Errorf("%d, expected dirty %v, got %v", i, e, a)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package notify
+
+import (
+	"errors"
+)
+
+var (
+	ErrWebhookRequest  = errors.New("Could not send the webhook request")
+	ErrWebhookResponse = errors.New("The webhook responded with an error status")
+)
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+)
+
+// Outcomes of a notified operation
+const (
+	OutcomeStarted   = "started"
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+)
+
+// timeout limits how long a webhook can hold up a deploy
+var timeout = 10 * time.Second
+
+// Payload is posted as JSON to every webhook. Text makes it a valid Slack incoming webhook
+// message, the other fields are for webhooks that process the notification. Duration is in
+// seconds and only set once the operation finished.
+type Payload struct {
+	Text      string   `json:"text"`
+	Operation string   `json:"operation"`
+	Cluster   string   `json:"cluster"`
+	Services  []string `json:"services"`
+	Commit    string   `json:"commit,omitempty"`
+	User      string   `json:"user"`
+	Outcome   string   `json:"outcome"`
+	Duration  float64  `json:"duration,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Send posts a payload to every webhook URL and returns an error for every webhook that
+// could not be reached or responded with a non-2xx status. The errors don't contain the URLs.
+// The text of the payload is generated when it is empty. Masked values are hidden in the
+// error and the text.
+func Send(urls []string, p *Payload) []error {
+	p.Error = term.Mask(p.Error)
+
+	if p.Text == "" {
+		p.Text = text(p)
+	}
+
+	p.Text = term.Mask(p.Text)
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return []error{err}
+	}
+
+	client := &http.Client{Timeout: timeout}
+	errs := []error{}
+
+	for _, webhook := range urls {
+		res, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			// The URL of a webhook is a secret token, e.g. of a Slack webhook
+			if urlErr, ok := err.(*url.Error); ok {
+				err = urlErr.Err
+			}
+
+			errs = append(errs, fmt.Errorf("%s: %s", ErrWebhookRequest, err))
+			continue
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			errs = append(errs, fmt.Errorf("%s: %s", ErrWebhookResponse, res.Status))
+		}
+	}
+
+	return errs
+}
+
+// text describes a payload in a single line, e.g.
+// dev@fuzzproductions.com deploy of a1b2c3d to dev (api, worker) succeeded in 2m13s
+func text(p *Payload) string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "%s %s", p.User, p.Operation)
+
+	if p.Commit != "" {
+		fmt.Fprintf(&out, " of %s", p.Commit)
+	}
+
+	fmt.Fprintf(&out, " to %s (%s) %s", p.Cluster, strings.Join(p.Services, ", "), p.Outcome)
+
+	if p.Duration > 0 {
+		fmt.Fprintf(&out, " in %s", time.Duration(p.Duration*float64(time.Second)).Round(time.Second))
+	}
+
+	if p.Error != "" {
+		fmt.Fprintf(&out, ": %s", p.Error)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fuzz-productions/ufo/pkg/term"
+)
+
+func TestSend(t *testing.T) {
+	term.AddMask("s3cr3t-value")
+
+	cases := []struct {
+		Payload  *Payload
+		Expected Payload
+	}{
+		{
+			Payload: &Payload{
+				Operation: "deploy",
+				Cluster:   "dev",
+				Services:  []string{"api", "worker"},
+				Commit:    "a1b2c3d",
+				User:      "dev@fuzzproductions.com",
+				Outcome:   OutcomeSucceeded,
+				Duration:  133,
+			},
+			Expected: Payload{
+				Text:      "dev@fuzzproductions.com deploy of a1b2c3d to dev (api, worker) succeeded in 2m13s",
+				Operation: "deploy",
+				Cluster:   "dev",
+				Services:  []string{"api", "worker"},
+				Commit:    "a1b2c3d",
+				User:      "dev@fuzzproductions.com",
+				Outcome:   OutcomeSucceeded,
+				Duration:  133,
+			},
+		},
+		{
+			Payload: &Payload{
+				Operation: "deploy",
+				Cluster:   "dev",
+				Services:  []string{"api"},
+				User:      "dev@fuzzproductions.com",
+				Outcome:   OutcomeFailed,
+				Error:     "build failed: token s3cr3t-value rejected",
+			},
+			Expected: Payload{
+				Text:      "dev@fuzzproductions.com deploy to dev (api) failed: build failed: token *** rejected",
+				Operation: "deploy",
+				Cluster:   "dev",
+				Services:  []string{"api"},
+				User:      "dev@fuzzproductions.com",
+				Outcome:   OutcomeFailed,
+				Error:     "build failed: token *** rejected",
+			},
+		},
+	}
+
+	for i, c := range cases {
+		var received Payload
+		var contentType string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType = r.Header.Get("Content-Type")
+			json.NewDecoder(r.Body).Decode(&received)
+		}))
+
+		errs := Send([]string{server.URL}, c.Payload)
+		server.Close()
+
+		if len(errs) != 0 {
+			t.Errorf("%d, expected no errors, got %v", i, errs)
+		}
+
+		if a, e := contentType, "application/json"; a != e {
+			t.Errorf("%d, expected content type %s, got %s", i, e, a)
+		}
+
+		if a, e := received, c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected payload %+v, got %+v", i, e, a)
+		}
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	defer func(d time.Duration) { timeout = d }(timeout)
+	timeout = 100 * time.Millisecond
+
+	cases := []struct {
+		Handler  http.HandlerFunc
+		Expected string
+	}{
+		{
+			Handler:  func(w http.ResponseWriter, r *http.Request) {},
+			Expected: "",
+		},
+		{
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			Expected: ErrWebhookResponse.Error(),
+		},
+		{
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Second)
+			},
+			Expected: ErrWebhookRequest.Error(),
+		},
+	}
+
+	// The path of a Slack webhook URL is a secret token
+	token := "/services/T00000000/B00000000/XXXXXXXXXXXXXXXXXXXXXXXX"
+
+	for i, c := range cases {
+		server := httptest.NewServer(c.Handler)
+		reached := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		started := time.Now()
+		errs := Send([]string{server.URL + token, reached.URL + token}, &Payload{Text: "test"})
+		elapsed := time.Since(started)
+
+		server.Close()
+		reached.Close()
+
+		if elapsed > time.Second/2 {
+			t.Errorf("%d, expected the webhooks to time out, took %s", i, elapsed)
+		}
+
+		if c.Expected == "" {
+			if len(errs) != 0 {
+				t.Errorf("%d, expected no errors, got %v", i, errs)
+			}
+
+			continue
+		}
+
+		if len(errs) != 1 {
+			t.Errorf("%d, expected 1 error, got %v", i, errs)
+			continue
+		}
+
+		if a, e := errs[0].Error(), c.Expected; !strings.HasPrefix(a, e) {
+			t.Errorf("%d, expected error starting with %s, got %s", i, e, a)
+		}
+
+		if a := errs[0].Error(); strings.Contains(a, token) {
+			t.Errorf("%d, expected error without the webhook URL, got %s", i, a)
+		}
+	}
+}
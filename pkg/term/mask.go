@@ -0,0 +1,107 @@
+package term
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// minMaskLength is the length a value needs to be masked, masking shorter values would
+// garble the output without hiding anything worth hiding
+const minMaskLength = 4
+
+// mask replaces masked values
+const mask = "***"
+
+var (
+	masksMu sync.RWMutex
+	masks   []string
+)
+
+// AddMask hides a value, e.g. a resolved secret, in everything written through a masked writer.
+// Output is usually written a line at a time, so every line of a multi-line value, like a
+// PEM key, is masked on its own as well.
+func AddMask(value string) {
+	values := []string{value}
+
+	if strings.Contains(value, "\n") {
+		for _, line := range strings.Split(value, "\n") {
+			values = append(values, strings.TrimSpace(line))
+		}
+	}
+
+	masksMu.Lock()
+	defer masksMu.Unlock()
+
+	for _, v := range values {
+		if len(v) >= minMaskLength {
+			masks = append(masks, v)
+		}
+	}
+}
+
+// Mask replaces every masked value in s
+func Mask(s string) string {
+	masksMu.RLock()
+	defer masksMu.RUnlock()
+
+	for _, value := range masks {
+		s = strings.Replace(s, value, mask, -1)
+	}
+
+	return s
+}
+
+// maskedWriter masks the values added with AddMask in everything written to it. The end of a
+// write that could be the start of a masked value is held back until the next write.
+type maskedWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	pending string
+}
+
+// MaskedWriter returns a writer that masks the values added with AddMask before writing to w.
+// A value, or a line of a multi-line value, is also masked when it is split across writes.
+func MaskedWriter(w io.Writer) io.Writer {
+	return &maskedWriter{w: w}
+}
+
+func (m *maskedWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := Mask(m.pending + string(p))
+	n := maskPrefixLength(s)
+	m.pending = s[len(s)-n:]
+
+	if _, err := io.WriteString(m.w, s[:len(s)-n]); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// maskPrefixLength returns the length of the longest end of the last line of s that is the
+// start of a masked value
+func maskPrefixLength(s string) int {
+	masksMu.RLock()
+	defer masksMu.RUnlock()
+
+	longest := 0
+
+	for _, value := range masks {
+		// Only the first line of a multi-line value can start on the last line
+		if i := strings.Index(value, "\n"); i >= 0 {
+			value = value[:i+1]
+		}
+
+		for n := len(value) - 1; n > longest; n-- {
+			if strings.HasSuffix(s, value[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+
+	return longest
+}
@@ -0,0 +1,91 @@
+package term
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	AddMask("s3cr3t")
+	AddMask("abc")
+	AddMask("-----BEGIN KEY-----\nMIIEpAIBAAKCAQEA\nqk9wXy1Z\n-----END KEY-----\n")
+
+	cases := []struct {
+		In       string
+		Expected string
+	}{
+		{In: "token=s3cr3t", Expected: "token=***"},
+		{In: "s3cr3t and s3cr3t", Expected: "*** and ***"},
+		{In: "abc is too short to mask", Expected: "abc is too short to mask"},
+		{In: "-----BEGIN KEY-----\nMIIEpAIBAAKCAQEA\nqk9wXy1Z\n-----END KEY-----\n", Expected: "***"},
+		{In: "  MIIEpAIBAAKCAQEA", Expected: "  ***"},
+		{In: "nothing to hide", Expected: "nothing to hide"},
+	}
+
+	for i, c := range cases {
+		if a, e := Mask(c.In), c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
+
+func TestMaskedWriter(t *testing.T) {
+	AddMask("p4ssw0rd")
+	AddMask("line-one-of-a-secret\nline-two-of-a-secret")
+
+	cases := []struct {
+		Writes   []string
+		Expected string
+	}{
+		{
+			Writes:   []string{"login with p4ssw0rd\n"},
+			Expected: "login with ***\n",
+		},
+		{
+			Writes:   []string{"line-one-of-a-secret\n", "line-two-of-a-secret\n"},
+			Expected: "***\n***\n",
+		},
+		{
+			Writes:   []string{"nothing to hide\n"},
+			Expected: "nothing to hide\n",
+		},
+		{
+			Writes:   []string{"login with p4s", "sw0rd\n"},
+			Expected: "login with ***\n",
+		},
+		{
+			Writes:   []string{"login with p", "4ssw", "0rd and p4ssw0rd\n"},
+			Expected: "login with *** and ***\n",
+		},
+		{
+			Writes:   []string{"line-one-of-", "a-secret\nline-two", "-of-a-secret\n"},
+			Expected: "***\n***\n",
+		},
+		{
+			Writes:   []string{"p4ss", "port\n"},
+			Expected: "p4ssport\n",
+		},
+	}
+
+	for i, c := range cases {
+		var buf bytes.Buffer
+		w := MaskedWriter(&buf)
+
+		for _, write := range c.Writes {
+			n, err := io.WriteString(w, write)
+
+			if err != nil {
+				t.Fatalf("%d, expected no error, got %s", i, err)
+			}
+
+			if a, e := n, len(write); a != e {
+				t.Errorf("%d, expected %d bytes written, got %d", i, e, a)
+			}
+		}
+
+		if a, e := buf.String(), c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
@@ -3,13 +3,19 @@ package term
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"runtime"
+	"sync"
 )
 
 var clear map[string]func()
 
+// Output receives the output of commands run with PrintStdout and PrintOutput. It can be set
+// to os.Stderr to keep stdout free for machine readable output. Masked values are hidden.
+var Output io.Writer = MaskedWriter(os.Stdout)
+
 func init() {
 	clear = make(map[string]func())
 
@@ -46,12 +52,12 @@ func PrintStdout(command *exec.Cmd) error {
 	stdout, err := command.StdoutPipe()
 
 	if err != nil {
-		fmt.Printf("%v", err)
+		fmt.Fprintf(Output, "%v", err)
 		return fmt.Errorf("Error creating a stdout pipe")
 	}
 
 	if err := command.Start(); err != nil {
-		fmt.Printf("%v", err)
+		fmt.Fprintf(Output, "%v", err)
 		return fmt.Errorf("Error starting the command")
 	}
 
@@ -59,14 +65,70 @@ func PrintStdout(command *exec.Cmd) error {
 	go func() {
 		for scanner.Scan() {
 			out := scanner.Text()
-			fmt.Println(out)
+			fmt.Fprintln(Output, out)
 		}
 	}()
 
 	if err := command.Wait(); err != nil {
-		fmt.Printf("%v", err)
+		fmt.Fprintf(Output, "%v", err)
+		return fmt.Errorf("Error waiting on releases of executed command")
+	}
+
+	return nil
+}
+
+// PrintOutput is PrintStdout for both the stdout and the stderr of a command. Both are printed
+// a line at a time, so a masked value is hidden even when the command writes it in pieces.
+func PrintOutput(command *exec.Cmd) error {
+	stdout, err := command.StdoutPipe()
+
+	if err != nil {
+		fmt.Fprintf(Output, "%v", err)
+		return fmt.Errorf("Error creating a stdout pipe")
+	}
+
+	stderr, err := command.StderrPipe()
+
+	if err != nil {
+		fmt.Fprintf(Output, "%v", err)
+		return fmt.Errorf("Error creating a stderr pipe")
+	}
+
+	if err := command.Start(); err != nil {
+		fmt.Fprintf(Output, "%v", err)
+		return fmt.Errorf("Error starting the command")
+	}
+
+	var wg sync.WaitGroup
+
+	for _, r := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+
+		go func(r io.Reader) {
+			defer wg.Done()
+			printLines(r)
+		}(r)
+	}
+
+	// Wait closes the pipes, so they are read to the end first
+	wg.Wait()
+
+	if err := command.Wait(); err != nil {
+		fmt.Fprintf(Output, "%v", err)
 		return fmt.Errorf("Error waiting on releases of executed command")
 	}
 
 	return nil
 }
+
+// printLines prints r to Output a line at a time. The rest of a line that is too long to scan
+// is copied as is, so the command never blocks on a full pipe.
+func printLines(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fmt.Fprintln(Output, scanner.Text())
+	}
+
+	io.Copy(Output, r)
+}
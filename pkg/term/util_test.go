@@ -0,0 +1,32 @@
+package term
+
+import (
+	"bytes"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPrintOutput(t *testing.T) {
+	AddMask("hunter22")
+
+	var buf bytes.Buffer
+
+	output := Output
+	Output = MaskedWriter(&buf)
+	defer func() { Output = output }()
+
+	cmd := exec.Command("sh", "-c", `echo stdout; printf "secret hun" >&2; sleep 0.1; printf "ter22\n" >&2`)
+
+	if err := PrintOutput(cmd); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(lines)
+
+	if a, e := strings.Join(lines, "\n"), "secret ***\nstdout"; a != e {
+		t.Errorf("expected %q, got %q", e, a)
+	}
+}
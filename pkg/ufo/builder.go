@@ -0,0 +1,356 @@
+package ufo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fuzz-productions/ufo/pkg/docker"
+	"github.com/fuzz-productions/ufo/pkg/term"
+	"github.com/pkg/errors"
+)
+
+// Builders that build and push the image of a deployment
+const (
+	BuilderDocker = "docker"
+	BuilderEngine = "engine"
+	BuilderBuildx = "buildx"
+	BuilderNone   = "none"
+	BuilderScript = "script"
+)
+
+// Builder builds the image of a build detail and pushes it with all its tags
+type Builder interface {
+	BuildPush(ctx aws.Context, info BuildDetail) error
+}
+
+// Builder returns the builder of a build detail, BuilderDocker when it has none
+func (u *UFO) Builder(info BuildDetail) (Builder, error) {
+	switch info.Builder {
+	case "", BuilderDocker:
+		if len(info.Platforms) > 1 {
+			return nil, errors.New(errMultiPlatformBuilder)
+		}
+
+		return &dockerBuilder{u: u}, nil
+	case BuilderEngine:
+		if len(info.Platforms) > 1 {
+			return nil, errors.New(errMultiPlatformBuilder)
+		}
+
+		if len(info.Secrets) > 0 || len(info.SSH) > 0 {
+			return nil, docker.ErrEngineBuildKit
+		}
+
+		return &engineBuilder{u: u}, nil
+	case BuilderBuildx:
+		return &buildxBuilder{u: u}, nil
+	case BuilderNone:
+		return &noneBuilder{u: u}, nil
+	case BuilderScript:
+		if info.BuildCommand == "" {
+			return nil, errors.New(errNoBuildCommand)
+		}
+
+		return &scriptBuilder{u: u}, nil
+	}
+
+	return nil, errors.Errorf("%s: %s", errUnknownBuilder, info.Builder)
+}
+
+func (u *UFO) LoginBuildPushImage(info BuildDetail) error {
+	return u.LoginBuildPushImageWithContext(aws.BackgroundContext(), info)
+}
+
+// LoginBuildPushImageWithContext is LoginBuildPushImage with a context to cancel its requests
+func (u *UFO) LoginBuildPushImageWithContext(ctx aws.Context, info BuildDetail) error {
+	builder, err := u.Builder(info)
+
+	if err != nil {
+		return err
+	}
+
+	return builder.BuildPush(ctx, info)
+}
+
+// buildOptions returns the docker build options of a build detail
+func buildOptions(info BuildDetail) *docker.BuildOptions {
+	return &docker.BuildOptions{
+		Repo:            info.Repo,
+		Tag:             info.CommitHash,
+		Tags:            info.Tags,
+		Dockerfile:      info.Dockerfile,
+		Dir:             info.Dir,
+		BuildArgs:       info.buildArgs,
+		ConfigBuildArgs: info.configBuildArgs,
+		CacheFrom:       info.CacheFrom,
+		Platforms:       info.Platforms,
+		Context:         info.Context,
+		Target:          info.Target,
+		Labels:          info.Labels,
+		Secrets:         info.Secrets,
+		SSH:             info.SSH,
+	}
+}
+
+// imageTags returns every tag the image of a build detail is pushed with
+func imageTags(info BuildDetail) []string {
+	return append([]string{info.CommitHash}, info.Tags...)
+}
+
+// dockerBuilder builds and pushes with the docker binary
+type dockerBuilder struct {
+	u *UFO
+}
+
+func (b *dockerBuilder) BuildPush(ctx aws.Context, info BuildDetail) error {
+	var err error
+
+	err = b.u.ECRLoginWithContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	image := fmt.Sprintf("%s:%s", info.Repo, info.CommitHash)
+
+	// A cache image that can't be pulled, e.g. the first build of a branch, only makes the
+	// build slower
+	for _, cache := range info.CacheFrom {
+		docker.ImagePull(cache)
+	}
+
+	b.u.Report(&Event{Type: EventBuildStarted, Image: image})
+
+	err = docker.ImageBuild(buildOptions(info))
+
+	if err != nil {
+		b.u.Report(&Event{Type: EventFailed, Image: image, Error: err.Error()})
+		return err
+	}
+
+	for _, tag := range imageTags(info) {
+		image := fmt.Sprintf("%s:%s", info.Repo, tag)
+
+		err = docker.ImagePush(info.Repo, tag)
+
+		if err != nil {
+			b.u.Report(&Event{Type: EventFailed, Image: image, Error: err.Error()})
+			return err
+		}
+
+		b.u.Report(&Event{Type: EventImagePushed, Image: image})
+	}
+
+	return nil
+}
+
+// engineBuilder builds and pushes through the Docker Engine API. The pushed events carry the
+// digest of the image.
+type engineBuilder struct {
+	u *UFO
+}
+
+func (b *engineBuilder) BuildPush(ctx aws.Context, info BuildDetail) error {
+	auth, err := b.u.ECRAuthWithContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	engine := docker.NewEngine()
+	image := fmt.Sprintf("%s:%s", info.Repo, info.CommitHash)
+
+	// A cache image that can't be pulled, e.g. the first build of a branch, only makes the
+	// build slower
+	for _, cache := range info.CacheFrom {
+		engine.ImagePull(ctx, cache, auth)
+	}
+
+	b.u.Report(&Event{Type: EventBuildStarted, Image: image})
+
+	err = engine.ImageBuild(ctx, buildOptions(info))
+
+	if err != nil {
+		b.u.Report(&Event{Type: EventFailed, Image: image, Error: err.Error()})
+		return err
+	}
+
+	for _, tag := range imageTags(info) {
+		image := fmt.Sprintf("%s:%s", info.Repo, tag)
+
+		digest, err := engine.ImagePush(ctx, info.Repo, tag, auth)
+
+		if err != nil {
+			b.u.Report(&Event{Type: EventFailed, Image: image, Error: err.Error()})
+			return err
+		}
+
+		b.u.Report(&Event{Type: EventImagePushed, Image: image, Digest: digest})
+	}
+
+	return nil
+}
+
+// buildxBuilder builds and pushes in one step with docker buildx
+type buildxBuilder struct {
+	u *UFO
+}
+
+func (b *buildxBuilder) BuildPush(ctx aws.Context, info BuildDetail) error {
+	err := b.u.ECRLoginWithContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	image := fmt.Sprintf("%s:%s", info.Repo, info.CommitHash)
+
+	b.u.Report(&Event{Type: EventBuildStarted, Image: image})
+
+	err = docker.BuildxBuild(buildOptions(info))
+
+	if err != nil {
+		b.u.Report(&Event{Type: EventFailed, Image: image, Error: err.Error()})
+		return err
+	}
+
+	for _, tag := range imageTags(info) {
+		b.u.Report(&Event{Type: EventImagePushed, Image: fmt.Sprintf("%s:%s", info.Repo, tag)})
+	}
+
+	return nil
+}
+
+// noneBuilder builds nothing, the image is produced elsewhere. It only makes sure the image
+// exists in ECR and adds the other tags to it.
+type noneBuilder struct {
+	u *UFO
+}
+
+func (b *noneBuilder) BuildPush(ctx aws.Context, info BuildDetail) error {
+	image := fmt.Sprintf("%s:%s", info.Repo, info.CommitHash)
+
+	exists, err := b.u.ImageExistsWithContext(ctx, info.Repo, info.CommitHash)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		err = errors.Errorf("%s: %s", errImageNotBuilt, image)
+		b.u.Report(&Event{Type: EventFailed, Image: image, Error: err.Error()})
+		return err
+	}
+
+	return b.u.TagImageWithContext(ctx, info.Repo, info.CommitHash, info.Tags)
+}
+
+// scriptBuilder runs the build command of a build detail, which has to build and push the
+// image and print its reference on the last line of its output, optionally followed by
+// @<digest>. The other tags are added to the image in ECR afterwards. The command runs in
+// bash in the build directory with the image in the environment:
+//
+//	UFO_IMAGE       the image to push, <repo>:<tag>
+//	UFO_REPO        the repo of the image
+//	UFO_TAG         the tag of the image that is deployed
+//	UFO_TAGS        the other tags of the image, separated by spaces
+//	UFO_DOCKERFILE  the dockerfile of the cluster
+//	UFO_PLATFORMS   the platforms to build for, separated by commas
+//	UFO_CONTEXT     the build context directory
+//	UFO_TARGET      the stage of the dockerfile to build
+type scriptBuilder struct {
+	u *UFO
+}
+
+func (b *scriptBuilder) BuildPush(ctx aws.Context, info BuildDetail) error {
+	image := fmt.Sprintf("%s:%s", info.Repo, info.CommitHash)
+
+	b.u.Report(&Event{Type: EventBuildStarted, Image: image})
+
+	printed, err := runBuildCommand(ctx, info)
+
+	// The image can be printed with its digest, <repo>:<tag>@<digest>
+	printedImage, digest := printed, ""
+	if i := strings.Index(printed, "@"); i >= 0 {
+		printedImage, digest = printed[:i], printed[i+1:]
+	}
+
+	if err == nil && printedImage != image {
+		err = errors.Errorf("%s: expected %s, got %q", errBuildCommandImage, image, printed)
+	}
+
+	if err == nil {
+		var exists bool
+
+		exists, err = b.u.ImageExistsWithContext(ctx, info.Repo, info.CommitHash)
+
+		if err == nil && !exists {
+			err = errors.Errorf("%s: %s", errImageNotBuilt, image)
+		}
+	}
+
+	if err == nil {
+		err = b.u.TagImageWithContext(ctx, info.Repo, info.CommitHash, info.Tags)
+	}
+
+	if err != nil {
+		b.u.Report(&Event{Type: EventFailed, Image: image, Error: err.Error()})
+		return err
+	}
+
+	for _, tag := range imageTags(info) {
+		b.u.Report(&Event{Type: EventImagePushed, Image: fmt.Sprintf("%s:%s", info.Repo, tag), Digest: digest})
+	}
+
+	return nil
+}
+
+// runBuildCommand runs the build command of a build detail, printing its output, and returns
+// the last line it printed
+func runBuildCommand(ctx aws.Context, info BuildDetail) (string, error) {
+	cmd := exec.CommandContext(ctx, "bash", "-c", info.BuildCommand)
+	cmd.Dir = info.Dir
+	cmd.Stderr = term.Output
+	cmd.Env = append(os.Environ(),
+		"UFO_IMAGE="+fmt.Sprintf("%s:%s", info.Repo, info.CommitHash),
+		"UFO_REPO="+info.Repo,
+		"UFO_TAG="+info.CommitHash,
+		"UFO_TAGS="+strings.Join(info.Tags, " "),
+		"UFO_DOCKERFILE="+info.Dockerfile,
+		"UFO_PLATFORMS="+strings.Join(info.Platforms, ","),
+		"UFO_CONTEXT="+buildOptions(info).Context,
+		"UFO_TARGET="+info.Target,
+	)
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return "", errors.Wrap(err, errBuildCommandFailed)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", errors.Wrap(err, errBuildCommandFailed)
+	}
+
+	last := ""
+	scanner := bufio.NewScanner(stdout)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Fprintln(term.Output, line)
+
+		if strings.TrimSpace(line) != "" {
+			last = strings.TrimSpace(line)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return "", errors.Wrap(err, errBuildCommandFailed)
+	}
+
+	return last, nil
+}
@@ -3,17 +3,20 @@ package ufo
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecs"
-	"github.com/fuzz-productions/ufo/pkg/docker"
+	"github.com/pkg/errors"
 )
 
 type Deployment struct {
 	DeployDetails []*DeployDetail
 	BuildDetail   BuildDetail
+	Operation     *Operation
 	Err           error
 }
 
@@ -21,15 +24,70 @@ type DeployDetail struct {
 	Cluster                  *ecs.Cluster
 	Service                  *ecs.Service
 	TaskDefinition           *ecs.TaskDefinition
+	PreviousTaskDefinition   *ecs.TaskDefinition
 	TaskDefinitionFamilyName string
 	RevisionNumber           int
 	Done                     bool
+	Failed                   bool
+}
+
+// Statuses of a ServiceResult
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+	ResultSkipped   = "skipped"
+)
+
+// ServiceResult is the outcome of an operation on a single service of a deployment
+type ServiceResult struct {
+	Detail *DeployDetail
+	Status string
+	Err    error
+}
+
+// ServiceResults are the outcomes of an operation on every service of a deployment
+type ServiceResults []*ServiceResult
+
+// Err returns the error of the first service that failed, or nil when none failed
+func (r ServiceResults) Err() error {
+	for _, result := range r {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+
+	return nil
+}
+
+// Succeeded returns the deploy details of the services the operation succeeded for
+func (r ServiceResults) Succeeded() []*DeployDetail {
+	details := []*DeployDetail{}
+
+	for _, result := range r {
+		if result.Status == ResultSucceeded {
+			details = append(details, result.Detail)
+		}
+	}
+
+	return details
 }
 
 type BuildDetail struct {
 	Repo            string
 	CommitHash      string
+	Tags            []string
+	CacheFrom       []string
+	Builder         string
+	BuildCommand    string
+	Platforms       []string
+	Context         string
+	Target          string
+	Labels          []string
+	Secrets         []string
+	SSH             []string
 	Dockerfile      string
+	Dir             string
+	ContainerRepos  map[string]string
 	buildArgs       []string
 	configBuildArgs []string
 }
@@ -46,10 +104,18 @@ func (d *DeployDetail) SetTaskDefinition(taskDef *ecs.TaskDefinition) {
 	d.TaskDefinition = taskDef
 }
 
+func (d *DeployDetail) SetPreviousTaskDefinition(taskDef *ecs.TaskDefinition) {
+	d.PreviousTaskDefinition = taskDef
+}
+
 func (d *DeployDetail) SetDone(done bool) {
 	d.Done = done
 }
 
+func (d *DeployDetail) SetFailed(failed bool) {
+	d.Failed = failed
+}
+
 func (d *DeployDetail) SetTaskDefinitionFamilyName(TaskDefinitionFamilyName string) {
 	d.TaskDefinitionFamilyName = TaskDefinitionFamilyName
 }
@@ -58,6 +124,11 @@ func (d *DeployDetail) SetRevisionNumber(revisionNumber int) {
 	d.RevisionNumber = revisionNumber
 }
 
+// SetOperation sets the operation recorded on the task definitions registered by the deployment
+func (d *Deployment) SetOperation(op *Operation) {
+	d.Operation = op
+}
+
 func (d *Deployment) SetRepo(repo string) {
 	d.BuildDetail.Repo = repo
 }
@@ -66,10 +137,142 @@ func (d *Deployment) SetCommitHash(commit string) {
 	d.BuildDetail.CommitHash = commit
 }
 
+// SetTags sets the additional tags the image is pushed with. The task definitions use the
+// commit hash tag.
+func (d *Deployment) SetTags(tags []string) {
+	d.BuildDetail.Tags = tags
+}
+
+// SetCacheFrom sets the images that are pulled and used as layer cache of the build
+func (d *Deployment) SetCacheFrom(images []string) {
+	d.BuildDetail.CacheFrom = images
+}
+
+// DeployedImages returns the images of the deployment's repo that its services currently
+// run, without duplicates. They share most layers with the image that is built.
+func (d *Deployment) DeployedImages() []string {
+	seen := map[string]bool{}
+	images := []string{}
+
+	for _, detail := range d.DeployDetails {
+		if detail.TaskDefinition == nil {
+			continue
+		}
+
+		for _, container := range detail.TaskDefinition.ContainerDefinitions {
+			image := aws.StringValue(container.Image)
+
+			if !strings.HasPrefix(image, d.BuildDetail.Repo+":") || seen[image] {
+				continue
+			}
+
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+
+	return images
+}
+
+// Repos returns the repos the image of the deployment is deployed from, sorted and without
+// duplicates. They are read from the current task definitions the way UpdateTaskDefinitionImage
+// reads them, so a container without a configured repo keeps the repo of the image it runs.
+func (d *Deployment) Repos() []string {
+	seen := map[string]bool{}
+	repos := []string{}
+
+	add := func(t *ecs.TaskDefinition, name string, repo string) {
+		if repo == "" {
+			container, err := containerDefinition(t, name)
+			if err != nil {
+				return
+			}
+
+			repo = imageRepo(aws.StringValue(container.Image))
+		}
+
+		if !seen[repo] {
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+
+	for _, detail := range d.DeployDetails {
+		if detail.TaskDefinition == nil {
+			continue
+		}
+
+		if len(d.BuildDetail.ContainerRepos) == 0 {
+			add(detail.TaskDefinition, "", "")
+		}
+
+		for name, repo := range d.BuildDetail.ContainerRepos {
+			add(detail.TaskDefinition, name, repo)
+		}
+	}
+
+	sort.Strings(repos)
+
+	return repos
+}
+
+// SetBuilder sets how the image is built and pushed, BuilderDocker when empty
+func (d *Deployment) SetBuilder(builder string) {
+	d.BuildDetail.Builder = builder
+}
+
+// SetBuildCommand sets the command BuilderScript runs to build and push the image
+func (d *Deployment) SetBuildCommand(command string) {
+	d.BuildDetail.BuildCommand = command
+}
+
+// SetPlatforms sets the platforms the image is built for, e.g. linux/amd64 and linux/arm64.
+// More than one platform needs a builder that can push a manifest list.
+func (d *Deployment) SetPlatforms(platforms []string) {
+	d.BuildDetail.Platforms = platforms
+}
+
+// SetContext sets the build context directory, relative to the build directory
+func (d *Deployment) SetContext(context string) {
+	d.BuildDetail.Context = context
+}
+
+// SetTarget sets the stage of a multi-stage dockerfile that is built
+func (d *Deployment) SetTarget(target string) {
+	d.BuildDetail.Target = target
+}
+
+// SetLabels sets the key=value labels of the image
+func (d *Deployment) SetLabels(labels []string) {
+	d.BuildDetail.Labels = labels
+}
+
+// SetSecrets sets the build secrets, e.g. id=npm,src=.npmrc. Secrets are mounted into RUN
+// instructions and never stored in the image.
+func (d *Deployment) SetSecrets(secrets []string) {
+	d.BuildDetail.Secrets = secrets
+}
+
+// SetSSH sets the ssh agent sockets or keys forwarded to the build, e.g. default
+func (d *Deployment) SetSSH(ssh []string) {
+	d.BuildDetail.SSH = ssh
+}
+
 func (d *Deployment) SetDockerfile(dockerfile string) {
 	d.BuildDetail.Dockerfile = dockerfile
 }
 
+// SetDir sets the directory the image is built in, the current directory when empty
+func (d *Deployment) SetDir(dir string) {
+	d.BuildDetail.Dir = dir
+}
+
+// SetContainerRepos sets the containers, by name, whose image is replaced on deploy.
+// A container mapped to an empty repo keeps the repo of its current image.
+func (d *Deployment) SetContainerRepos(repos map[string]string) {
+	d.BuildDetail.ContainerRepos = repos
+}
+
 func (d *Deployment) SetBuildArgs(buildArgs []string) {
 	d.BuildDetail.buildArgs = buildArgs
 }
@@ -105,92 +308,348 @@ func (u *UFO) NewDeployDetail() *DeployDetail {
 	}
 }
 
+// AwaitServicesRunning polls every service of a deployment until it reaches a steady state,
+// see ServiceProgress.Stable, or ECS reports its rollout as failed. Each detail is sent on
+// the returned channel once it is done.
 func (u *UFO) AwaitServicesRunning(deployment *Deployment) chan *DeployDetail {
+	return u.AwaitServicesRunningWithContext(aws.BackgroundContext(), deployment)
+}
+
+// AwaitServicesRunningWithContext is AwaitServicesRunning with a context to stop polling.
+// Services that are still deploying when ctx is done are not sent on the channel. The channel
+// is closed once no service is polled anymore, so a caller that cancels ctx can drain it to
+// wait for the polling to stop before changing the deployment.
+func (u *UFO) AwaitServicesRunningWithContext(ctx aws.Context, deployment *Deployment) chan *DeployDetail {
 	waitTime := time.Second * 2
-	doneCh := make(chan *DeployDetail)
+	doneCh := make(chan *DeployDetail, len(deployment.DeployDetails))
+
+	var wg sync.WaitGroup
+	wg.Add(len(deployment.DeployDetails))
+
 	for _, detail := range deployment.DeployDetails {
 		go func(detail *DeployDetail) {
+			defer wg.Done()
+
+			var last ServiceProgress
+
 			for !detail.Done {
-				done := u.IsServiceRunning(detail)
-				detail.SetDone(done)
-				time.Sleep(waitTime)
+				// A failed request is retried on the next poll
+				progress, err := u.GetServiceProgressWithContext(ctx, detail)
+
+				if err == nil {
+					if progress.Failed() {
+						detail.SetFailed(true)
+						break
+					}
+
+					if *progress != last {
+						last = *progress
+
+						e := detailEvent(EventServiceProgress, detail, nil)
+						e.Progress = progress
+						u.Report(e)
+					}
+
+					detail.SetDone(progress.Stable())
+				}
+
+				if detail.Done {
+					break
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(waitTime):
+				}
 			}
+
+			if detail.Failed {
+				u.Report(detailEvent(EventFailed, detail, errors.New(errDeploymentFailed)))
+			} else {
+				u.Report(detailEvent(EventServiceStable, detail, nil))
+			}
+
 			doneCh <- detail
 		}(detail)
 	}
 
+	go func() {
+		wg.Wait()
+		close(doneCh)
+	}()
+
 	return doneCh
 }
 
-func (u *UFO) RollbackAll(deploy *Deployment, deployDetail *DeployDetail) <-chan error {
-	var wg sync.WaitGroup
-	errCh := make(chan error)
+// RollbackAll rolls every service of a deployment back to the revision number of deployDetail,
+// or the revision before the current one when it is 0. See RollbackTaskDefinition.
+func (u *UFO) RollbackAll(deploy *Deployment, deployDetail *DeployDetail) ServiceResults {
+	return u.RollbackAllWithContext(aws.BackgroundContext(), deploy, deployDetail)
+}
 
-	wg.Add(len(deploy.DeployDetails))
-	for _, detail := range deploy.DeployDetails {
-		go func(detail *DeployDetail) {
-			taskDefName, err := u.RollbackTaskDefinition(detail.Cluster, detail.Service, detail.TaskDefinition, deployDetail.RevisionNumber)
+// RollbackAllWithContext is RollbackAll with a context to cancel its requests
+func (u *UFO) RollbackAllWithContext(ctx aws.Context, deploy *Deployment, deployDetail *DeployDetail) ServiceResults {
+	return u.eachService(ctx, deploy.DeployDetails, nil, func(detail *DeployDetail) error {
+		target, taskDefName, err := u.rollbackTaskDefinition(ctx, detail.Cluster, detail.Service, detail.TaskDefinition, deployDetail.RevisionNumber, deploy.Operation)
 
-			if err != nil {
-				errCh <- err
-				wg.Done()
-			}
-			detail.SetTaskDefinitionFamilyName(taskDefName)
+		if err != nil {
+			return err
+		}
 
-			wg.Done()
-		}(detail)
+		detail.SetPreviousTaskDefinition(detail.TaskDefinition)
+		detail.SetTaskDefinition(target)
+		detail.SetTaskDefinitionFamilyName(taskDefName)
+
+		u.Report(detailEvent(EventServiceRolledBack, detail, nil))
+
+		return nil
+	})
+}
+
+// RevertAll moves every service of a deployment back to the task definition it ran
+// before DeployAll, see Revert
+func (u *UFO) RevertAll(deploy *Deployment) ServiceResults {
+	return u.RevertAllWithContext(aws.BackgroundContext(), deploy)
+}
+
+// RevertAllWithContext is RevertAll with a context to cancel its requests
+func (u *UFO) RevertAllWithContext(ctx aws.Context, deploy *Deployment) ServiceResults {
+	return u.RevertWithContext(ctx, deploy.DeployDetails)
+}
+
+// Revert moves services back to the task definition they ran before DeployAll. Services
+// without a previous task definition are skipped.
+func (u *UFO) Revert(details []*DeployDetail) ServiceResults {
+	return u.RevertWithContext(aws.BackgroundContext(), details)
+}
+
+// RevertWithContext is Revert with a context to cancel its requests
+func (u *UFO) RevertWithContext(ctx aws.Context, details []*DeployDetail) ServiceResults {
+	skip := func(detail *DeployDetail) bool {
+		return detail.PreviousTaskDefinition == nil
 	}
 
-	wg.Wait()
-	close(errCh)
-	return errCh
+	return u.eachService(ctx, details, skip, func(detail *DeployDetail) error {
+		if _, err := u.UpdateServiceWithContext(ctx, detail.Cluster, detail.Service, detail.PreviousTaskDefinition); err != nil {
+			return err
+		}
+
+		detail.SetTaskDefinition(detail.PreviousTaskDefinition)
+		detail.SetPreviousTaskDefinition(nil)
+
+		u.Report(detailEvent(EventServiceRolledBack, detail, nil))
+
+		return nil
+	})
 }
 
-func (u *UFO) DeployAll(deploy *Deployment) <-chan error {
-	var wg sync.WaitGroup
-	errCh := make(chan error)
+// DeployAll registers a new task definition for every service and updates the services
+// to use it, see RegisterAll and UpdateAll. No service is updated when a task definition
+// can't be registered, the results of RegisterAll are returned instead.
+func (u *UFO) DeployAll(deploy *Deployment) ServiceResults {
+	return u.DeployAllWithContext(aws.BackgroundContext(), deploy)
+}
 
-	wg.Add(len(deploy.DeployDetails))
-	for _, detail := range deploy.DeployDetails {
-		go func(detail *DeployDetail) {
-			taskDef, err := u.UpdateServiceWithNewTaskDefinition(detail.Cluster, detail.Service, deploy.BuildDetail.CommitHash)
+// DeployAllWithContext is DeployAll with a context to cancel its requests
+func (u *UFO) DeployAllWithContext(ctx aws.Context, deploy *Deployment) ServiceResults {
+	results := u.RegisterAllWithContext(ctx, deploy)
 
-			if err != nil {
-				errCh <- err
-				wg.Done()
+	if results.Err() != nil {
+		return results
+	}
+
+	return u.UpdateAllWithContext(ctx, deploy)
+}
+
+// RegisterAll registers a new task definition with the deployment's image for every service
+// without updating the services. The TaskDefinition of each detail is set to the newly
+// registered one and PreviousTaskDefinition to the one the service currently runs. A service
+// whose task definition requires a CPU architecture the image was not built for fails.
+func (u *UFO) RegisterAll(deploy *Deployment) ServiceResults {
+	return u.RegisterAllWithContext(aws.BackgroundContext(), deploy)
+}
+
+// RegisterAllWithContext is RegisterAll with a context to cancel its requests
+func (u *UFO) RegisterAllWithContext(ctx aws.Context, deploy *Deployment) ServiceResults {
+	checkPlatform := u.platformCheck(ctx, deploy.BuildDetail)
+
+	return u.eachService(ctx, deploy.DeployDetails, nil, func(detail *DeployDetail) error {
+		if err := checkPlatform(detail.TaskDefinition); err != nil {
+			return err
+		}
+
+		taskDef, err := u.RegisterTaskDefinitionWithImageWithContext(ctx, detail.Cluster, detail.Service, deploy.BuildDetail.CommitHash, deploy.BuildDetail.ContainerRepos, deploy.Operation)
+
+		if err != nil {
+			return err
+		}
+
+		detail.SetPreviousTaskDefinition(detail.TaskDefinition)
+		detail.SetTaskDefinition(taskDef)
+
+		u.Report(detailEvent(EventTaskDefinitionRegistered, detail, nil))
+
+		return nil
+	})
+}
+
+// UpdateAll updates every service to the TaskDefinition of its deploy detail. Services
+// without a task definition registered by RegisterAll are skipped.
+func (u *UFO) UpdateAll(deploy *Deployment) ServiceResults {
+	return u.UpdateAllWithContext(aws.BackgroundContext(), deploy)
+}
+
+// UpdateAllWithContext is UpdateAll with a context to cancel its requests
+func (u *UFO) UpdateAllWithContext(ctx aws.Context, deploy *Deployment) ServiceResults {
+	skip := func(detail *DeployDetail) bool {
+		return detail.PreviousTaskDefinition == nil
+	}
+
+	return u.eachService(ctx, deploy.DeployDetails, skip, func(detail *DeployDetail) error {
+		if _, err := u.UpdateServiceWithContext(ctx, detail.Cluster, detail.Service, detail.TaskDefinition); err != nil {
+			return err
+		}
+
+		u.Report(detailEvent(EventServiceUpdated, detail, nil))
+
+		return nil
+	})
+}
+
+// eachService runs fn concurrently for every deploy detail and returns a result for every
+// detail, in the same order. Details for which skip returns true, or all details once ctx
+// is done, are not run.
+func (u *UFO) eachService(ctx aws.Context, details []*DeployDetail, skip func(*DeployDetail) bool, fn func(*DeployDetail) error) ServiceResults {
+	var wg sync.WaitGroup
+	results := make(ServiceResults, len(details))
+
+	for i, detail := range details {
+		results[i] = &ServiceResult{Detail: detail}
+
+		if ctx.Err() != nil || (skip != nil && skip(detail)) {
+			results[i].Status = ResultSkipped
+			u.Report(detailEvent(EventServiceSkipped, detail, nil))
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *ServiceResult) {
+			defer wg.Done()
+
+			if err := fn(result.Detail); err != nil {
+				result.Status = ResultFailed
+				result.Err = err
+				u.Report(detailEvent(EventFailed, result.Detail, err))
+				return
 			}
 
-			// Set TaskDefinition to the updated services new TaskDefinition
-			detail.SetTaskDefinition(taskDef)
-			wg.Done()
-		}(detail)
+			result.Status = ResultSucceeded
+		}(results[i])
 	}
 
 	wg.Wait()
-	close(errCh)
-	return errCh
+	return results
+}
+
+// States of the service of a deploy detail, see GetServiceState
+const (
+	StateNotUpdated = "not updated"
+	StateRollingOut = "rolling out"
+	StateUpdated    = "updated"
+)
+
+// ServiceState is the state a deployment left a service in. TaskDefinition is the family and
+// revision of the service's primary deployment.
+type ServiceState struct {
+	Detail         *DeployDetail
+	State          string
+	TaskDefinition string
 }
 
-func (u *UFO) LoginBuildPushImage(info BuildDetail) error {
-	var err error
+// GetServiceState returns whether the service of a deploy detail was updated to the detail's
+// new task definition and if ECS is still rolling it out
+func (u *UFO) GetServiceState(detail *DeployDetail) (*ServiceState, error) {
+	return u.GetServiceStateWithContext(aws.BackgroundContext(), detail)
+}
 
-	err = u.ECRLogin()
+// GetServiceStateWithContext is GetServiceState with a context to cancel its requests
+func (u *UFO) GetServiceStateWithContext(ctx aws.Context, detail *DeployDetail) (*ServiceState, error) {
+	s, err := u.GetServiceWithContext(ctx, detail.Cluster, *detail.Service.ServiceArn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := regexp.MustCompile(`([^\/]+)$`)
+	state := &ServiceState{
+		Detail:         detail,
+		State:          StateNotUpdated,
+		TaskDefinition: r.FindString(aws.StringValue(s.TaskDefinition)),
+	}
+
+	// A detail without a previous task definition still holds the one the service ran
+	if detail.PreviousTaskDefinition == nil {
+		return state, nil
+	}
+
+	for _, deployment := range s.Deployments {
+		if aws.StringValue(deployment.Status) != "PRIMARY" {
+			continue
+		}
+
+		state.TaskDefinition = r.FindString(aws.StringValue(deployment.TaskDefinition))
+
+		if aws.StringValue(deployment.TaskDefinition) != aws.StringValue(detail.TaskDefinition.TaskDefinitionArn) {
+			break
+		}
+
+		state.State = StateUpdated
+
+		if len(s.Deployments) > 1 || aws.StringValue(deployment.RolloutState) == ecs.DeploymentRolloutStateInProgress {
+			state.State = StateRollingOut
+		}
+	}
+
+	return state, nil
+}
+
+// RunHook runs a command in a named container as a one off task with the TaskDefinition of a
+// deploy detail and waits for it to stop. An empty name selects the first container. An error
+// is returned if the command exits with a non-zero code.
+func (u *UFO) RunHook(detail *DeployDetail, container string, command string) error {
+	return u.RunHookWithContext(aws.BackgroundContext(), detail, container, command)
+}
+
+// RunHookWithContext is RunHook with a context to cancel its requests
+func (u *UFO) RunHookWithContext(ctx aws.Context, detail *DeployDetail, container string, command string) error {
+	target, err := containerDefinition(detail.TaskDefinition, container)
 
 	if err != nil {
 		return err
 	}
 
-	err = docker.ImageBuild(info.Repo, info.CommitHash, info.Dockerfile, info.buildArgs, info.configBuildArgs)
+	result, err := u.RunTaskInContainerWithContext(ctx, detail.Cluster, detail.TaskDefinition, aws.StringValue(target.Name), command)
 
 	if err != nil {
 		return err
 	}
 
-	err = docker.ImagePush(info.Repo, info.CommitHash)
+	task := result.Tasks[0].TaskArn
+
+	if err := u.IsTaskRunningWithContext(ctx, detail.Cluster.ClusterArn, task); err != nil {
+		return err
+	}
+
+	exitCode, err := u.GetTaskExitCodeWithContext(ctx, detail.Cluster, task, aws.StringValue(target.Name))
 
 	if err != nil {
 		return err
 	}
 
+	if exitCode != 0 {
+		return errors.Errorf("%s: %q exited with code %d", errHookFailed, command, exitCode)
+	}
+
 	return nil
 }
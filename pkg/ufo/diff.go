@@ -0,0 +1,141 @@
+package ufo
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// FieldDiff is a single changed field between two task definitions
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Plan is the task definition a deployment would register for a service
+type Plan struct {
+	Detail         *DeployDetail
+	TaskDefinition *ecs.TaskDefinition
+	Diff           []*FieldDiff
+}
+
+// PlanAll computes the task definition DeployAll would register for every service
+// in a deployment. Nothing is registered and no service is updated.
+func (u *UFO) PlanAll(deploy *Deployment) ([]*Plan, error) {
+	plans := make([]*Plan, 0, len(deploy.DeployDetails))
+
+	for _, detail := range deploy.DeployDetails {
+		taskDef, err := u.UpdateTaskDefinitionImage(*detail.TaskDefinition, deploy.BuildDetail.CommitHash, deploy.BuildDetail.ContainerRepos)
+
+		if err != nil {
+			return nil, err
+		}
+
+		plans = append(plans, &Plan{
+			Detail:         detail,
+			TaskDefinition: &taskDef,
+			Diff:           DiffTaskDefinitions(detail.TaskDefinition, &taskDef),
+		})
+	}
+
+	return plans, nil
+}
+
+// DiffTaskDefinitions compares the image, environment, cpu and memory of two task definitions
+// and its containers. Containers are matched by name.
+func DiffTaskDefinitions(old *ecs.TaskDefinition, new *ecs.TaskDefinition) []*FieldDiff {
+	diffs := make([]*FieldDiff, 0)
+
+	diffs = appendDiff(diffs, "cpu", aws.StringValue(old.Cpu), aws.StringValue(new.Cpu))
+	diffs = appendDiff(diffs, "memory", aws.StringValue(old.Memory), aws.StringValue(new.Memory))
+
+	oldContainers := map[string]*ecs.ContainerDefinition{}
+
+	for _, container := range old.ContainerDefinitions {
+		oldContainers[aws.StringValue(container.Name)] = container
+	}
+
+	for _, container := range new.ContainerDefinitions {
+		name := aws.StringValue(container.Name)
+		prefix := fmt.Sprintf("container[%s]", name)
+		oldContainer, ok := oldContainers[name]
+
+		if !ok {
+			diffs = appendDiff(diffs, prefix, "", "added")
+			continue
+		}
+
+		delete(oldContainers, name)
+
+		diffs = appendDiff(diffs, prefix+".image", aws.StringValue(oldContainer.Image), aws.StringValue(container.Image))
+		diffs = appendDiff(diffs, prefix+".cpu", int64String(oldContainer.Cpu), int64String(container.Cpu))
+		diffs = appendDiff(diffs, prefix+".memory", int64String(oldContainer.Memory), int64String(container.Memory))
+		diffs = appendDiff(diffs, prefix+".memoryReservation", int64String(oldContainer.MemoryReservation), int64String(container.MemoryReservation))
+		diffs = append(diffs, diffEnvironment(prefix+".environment", oldContainer.Environment, container.Environment)...)
+	}
+
+	removed := make([]string, 0, len(oldContainers))
+
+	for name := range oldContainers {
+		removed = append(removed, name)
+	}
+
+	sort.Strings(removed)
+
+	for _, name := range removed {
+		diffs = appendDiff(diffs, fmt.Sprintf("container[%s]", name), "present", "")
+	}
+
+	return diffs
+}
+
+// diffEnvironment compares environment variables by name, sorted by name
+func diffEnvironment(prefix string, old []*ecs.KeyValuePair, new []*ecs.KeyValuePair) []*FieldDiff {
+	diffs := make([]*FieldDiff, 0)
+	oldValues := map[string]string{}
+	newValues := map[string]string{}
+	names := make([]string, 0)
+
+	for _, kv := range old {
+		oldValues[aws.StringValue(kv.Name)] = aws.StringValue(kv.Value)
+		names = append(names, aws.StringValue(kv.Name))
+	}
+
+	for _, kv := range new {
+		if _, ok := oldValues[aws.StringValue(kv.Name)]; !ok {
+			names = append(names, aws.StringValue(kv.Name))
+		}
+		newValues[aws.StringValue(kv.Name)] = aws.StringValue(kv.Value)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		diffs = appendDiff(diffs, fmt.Sprintf("%s.%s", prefix, name), oldValues[name], newValues[name])
+	}
+
+	return diffs
+}
+
+func appendDiff(diffs []*FieldDiff, field string, old string, new string) []*FieldDiff {
+	if old == new {
+		return diffs
+	}
+
+	return append(diffs, &FieldDiff{
+		Field: field,
+		Old:   old,
+		New:   new,
+	})
+}
+
+func int64String(i *int64) string {
+	if i == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d", *i)
+}
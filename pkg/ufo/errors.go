@@ -10,18 +10,48 @@ var (
 	errCouldNotRetrieveTaskDefinition = "could not retrieve task definition"
 	errCouldNotRetrieveTasks          = "could not retrieve tasks"
 	errCouldNotRetrieveImages         = "could not retrieve images"
+	errImageNotFound                  = "image was not found"
+	errCouldNotTagImage               = "could not tag image"
+	errCouldNotReadManifest           = "could not read image manifest"
+	errImagePlatform                  = "image was not built for the CPU architecture of the task"
+	errCouldNotListTaskDefinitions    = "could not list task definitions"
 
 	errInvalidTaskDefinition = "task definition contains no container definitions"
+	errContainerNotFound     = "container was not found in task definition"
+	errImageHasNoTag         = "container image has no tag"
 
 	errCouldNotRegisterTaskDefinition = "could not register new task definition"
+	errCouldNotTagTaskDefinition      = "could not tag task definition"
 	errCouldNotUpdateService          = "could not update service"
+	errDeploymentFailed               = "ECS reported the deployment as failed"
 
 	errClusterNotFound = "cluster was not found"
 	errServiceNotFound = "service was not found"
 
-	errCouldNotRunTask = "desired task could not run"
+	errCouldNotRunTask     = "desired task could not run"
+	errTaskNotStarted      = "task could not be started"
+	errTaskNotFound        = "task was not found"
+	errTaskExitCodeUnknown = "task stopped without an exit code"
+	errHookFailed          = "deploy task failed"
+
+	errClusterLocked        = "cluster is locked"
+	errCouldNotRetrieveLock = "could not retrieve cluster lock"
+	errCouldNotAcquireLock  = "could not lock cluster"
+	errCouldNotReleaseLock  = "could not release cluster lock"
 
 	errCouldNotGetLogs = "could not get cloudwatch logs"
 
 	errECRLogin = "Could not login to ECR"
+
+	errUnknownBuilder       = "unknown builder, use docker, engine, buildx, none or script"
+	errNoBuildCommand       = "the script builder needs a build command"
+	errMultiPlatformBuilder = "building for several platforms needs the buildx or script builder"
+	errBuildCommandFailed   = "build command failed"
+	errBuildCommandImage    = "build command did not print the image it pushed"
+	errImageNotBuilt        = "image was not found in the repo, it has to be pushed before deploying"
+
+	errCouldNotScanImage = "could not scan image"
+	errScanNotFound      = "no scan was found for the image, enable scan on push or start the scan"
+	errScanFailed        = "image scan did not complete"
+	errUnknownSeverity   = "unknown severity, use CRITICAL, HIGH, MEDIUM, LOW, INFORMATIONAL or UNDEFINED"
 )
@@ -0,0 +1,83 @@
+package ufo
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/fuzz-productions/ufo/pkg/term"
+)
+
+// Event types reported during a deployment
+const (
+	EventBuildStarted             = "build_started"
+	EventImagePushed              = "image_pushed"
+	EventTaskDefinitionRegistered = "task_definition_registered"
+	EventServiceUpdated           = "service_updated"
+	EventServiceProgress          = "service_progress"
+	EventServiceStable            = "service_stable"
+	EventServiceRolledBack        = "service_rolled_back"
+	EventServiceSkipped           = "service_skipped"
+	EventWarning                  = "warning"
+	EventFailed                   = "failed"
+)
+
+// Event is a step of a deployment. Fields that don't apply to an event type are empty.
+// Digest is the digest of a pushed image when the builder reports it. Progress is reported
+// whenever the task counts of a service that is deploying change.
+type Event struct {
+	Type           string           `json:"type"`
+	Time           time.Time        `json:"time"`
+	Cluster        string           `json:"cluster,omitempty"`
+	Service        string           `json:"service,omitempty"`
+	TaskDefinition string           `json:"taskDefinition,omitempty"`
+	Image          string           `json:"image,omitempty"`
+	Digest         string           `json:"digest,omitempty"`
+	Progress       *ServiceProgress `json:"progress,omitempty"`
+	Error          string           `json:"error,omitempty"`
+}
+
+// Reporter receives the events of a deployment. Report is called from multiple goroutines
+// when services are deployed concurrently.
+type Reporter interface {
+	Report(e *Event)
+}
+
+// Report sends an event to the reporter of the UFO session, if it has one. The time of the
+// event is set when it is empty and masked values are hidden in its error.
+func (u *UFO) Report(e *Event) {
+	if u.Reporter == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	e.Error = term.Mask(e.Error)
+
+	u.Reporter.Report(e)
+}
+
+// detailEvent returns an event about the service of a deploy detail. The task definition of
+// the event is the detail's current task definition.
+func detailEvent(eventType string, detail *DeployDetail, err error) *Event {
+	e := &Event{Type: eventType}
+
+	if detail.Cluster != nil {
+		e.Cluster = aws.StringValue(detail.Cluster.ClusterName)
+	}
+
+	if detail.Service != nil {
+		e.Service = aws.StringValue(detail.Service.ServiceName)
+	}
+
+	if detail.TaskDefinition != nil && detail.TaskDefinition.TaskDefinitionArn != nil {
+		e.TaskDefinition = detail.TaskDefinitionFamily()
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	return e
+}
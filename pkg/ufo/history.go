@@ -0,0 +1,220 @@
+package ufo
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// Operations recorded on the task definitions registered by ufo
+const (
+	OperationDeploy   = "deploy"
+	OperationEnv      = "env"
+	OperationRollback = "rollback"
+)
+
+const (
+	tagDeployer  = "ufo:deployer"
+	tagOperation = "ufo:operation"
+	tagSource    = "ufo:source"
+
+	tagRollbackDeployer = "ufo:rollback-deployer"
+	tagRollbackSource   = "ufo:rollback-source"
+
+	// maxTagValueLength is the longest value ECS accepts for a tag
+	maxTagValueLength = 256
+)
+
+// Operation describes who registered a task definition revision and why. Source is the
+// revision a rollback replaced.
+type Operation struct {
+	Type     string
+	Deployer string
+	Source   string
+}
+
+// Revision is a task definition revision with the operation that registered it and the
+// latest rollback to it. Operation is nil for revisions that were not registered by ufo,
+// Rollback is nil for revisions that were never rolled back to.
+type Revision struct {
+	TaskDefinition *ecs.TaskDefinition
+	Operation      *Operation
+	Rollback       *Operation
+}
+
+// Tags returns the ECS tags recording an operation on a task definition
+func (o *Operation) Tags() []*ecs.Tag {
+	if o == nil {
+		return nil
+	}
+
+	tags := []*ecs.Tag{}
+
+	for _, tag := range []struct{ key, value string }{
+		{tagOperation, o.Type},
+		{tagDeployer, o.Deployer},
+		{tagSource, o.Source},
+	} {
+		if tag.value != "" {
+			tags = append(tags, &ecs.Tag{Key: aws.String(tag.key), Value: aws.String(tagValue(tag.value))})
+		}
+	}
+
+	return tags
+}
+
+// RollbackTags returns the ECS tags recording a rollback on the task definition it restored.
+// They don't replace the tags of the operation that registered the task definition.
+func (o *Operation) RollbackTags() []*ecs.Tag {
+	tags := []*ecs.Tag{}
+
+	for _, tag := range []struct{ key, value string }{
+		{tagRollbackDeployer, o.Deployer},
+		{tagRollbackSource, o.Source},
+	} {
+		if tag.value != "" {
+			tags = append(tags, &ecs.Tag{Key: aws.String(tag.key), Value: aws.String(tagValue(tag.value))})
+		}
+	}
+
+	return tags
+}
+
+// tagValue replaces the characters ECS doesn't accept in a tag value, like the ones a git
+// user.email can contain, with underscores and cuts the value to the length ECS accepts
+func tagValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || r == ' ' || strings.ContainsRune("+-=._:/@", r) {
+			return r
+		}
+
+		return '_'
+	}, value)
+
+	if runes := []rune(value); len(runes) > maxTagValueLength {
+		value = string(runes[:maxTagValueLength])
+	}
+
+	return value
+}
+
+// ImageTag returns the image tag of a named container of the revision, or of its first
+// container when name is empty
+func (r *Revision) ImageTag(name string) string {
+	container, err := containerDefinition(r.TaskDefinition, name)
+
+	if err != nil {
+		return ""
+	}
+
+	return imageTag(aws.StringValue(container.Image))
+}
+
+// operationFromTags reads an operation from the tags of a task definition
+func operationFromTags(tags []*ecs.Tag) *Operation {
+	var op *Operation
+
+	for _, tag := range tags {
+		if op == nil {
+			op = &Operation{}
+		}
+
+		switch aws.StringValue(tag.Key) {
+		case tagOperation:
+			op.Type = aws.StringValue(tag.Value)
+		case tagDeployer:
+			op.Deployer = aws.StringValue(tag.Value)
+		case tagSource:
+			op.Source = aws.StringValue(tag.Value)
+		}
+	}
+
+	if op == nil || op.Type == "" {
+		return nil
+	}
+
+	return op
+}
+
+// rollbackFromTags reads the latest rollback to a task definition from its tags
+func rollbackFromTags(tags []*ecs.Tag) *Operation {
+	op := &Operation{Type: OperationRollback}
+
+	for _, tag := range tags {
+		switch aws.StringValue(tag.Key) {
+		case tagRollbackDeployer:
+			op.Deployer = aws.StringValue(tag.Value)
+		case tagRollbackSource:
+			op.Source = aws.StringValue(tag.Value)
+		}
+	}
+
+	if op.Source == "" {
+		return nil
+	}
+
+	return op
+}
+
+// TaskDefinitionHistory returns up to limit active revisions of a task definition family,
+// newest first. No revisions are returned when limit is less than 1.
+func (u *UFO) TaskDefinitionHistory(family string, limit int) ([]*Revision, error) {
+	return u.TaskDefinitionHistoryWithContext(aws.BackgroundContext(), family, limit)
+}
+
+// TaskDefinitionHistoryWithContext is TaskDefinitionHistory with a context to cancel its requests
+func (u *UFO) TaskDefinitionHistoryWithContext(ctx aws.Context, family string, limit int) ([]*Revision, error) {
+	if limit < 1 {
+		return []*Revision{}, nil
+	}
+
+	r := regexp.MustCompile(`([^\/:]+):\d+$`)
+	arns := make([]*string, 0, limit)
+
+	err := u.ECS.ListTaskDefinitionsPagesWithContext(ctx, &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String(family),
+		Sort:         aws.String(ecs.SortOrderDesc),
+	}, func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+		for _, arn := range page.TaskDefinitionArns {
+			// FamilyPrefix also matches longer family names
+			if match := r.FindStringSubmatch(*arn); match != nil && match[1] == family {
+				arns = append(arns, arn)
+			}
+
+			if len(arns) >= limit {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, errCouldNotListTaskDefinitions)
+	}
+
+	revisions := make([]*Revision, 0, len(arns))
+
+	for _, arn := range arns {
+		result, err := u.ECS.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: arn,
+			Include:        aws.StringSlice([]string{ecs.TaskDefinitionFieldTags}),
+		})
+
+		if err != nil {
+			return nil, errors.Wrap(err, errCouldNotRetrieveTaskDefinition)
+		}
+
+		revisions = append(revisions, &Revision{
+			TaskDefinition: result.TaskDefinition,
+			Operation:      operationFromTags(result.Tags),
+			Rollback:       rollbackFromTags(result.Tags),
+		})
+	}
+
+	return revisions, nil
+}
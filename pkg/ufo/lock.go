@@ -0,0 +1,198 @@
+package ufo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+const (
+	tagLockID      = "ufo:lock:id"
+	tagLockHolder  = "ufo:lock:holder"
+	tagLockCommit  = "ufo:lock:commit"
+	tagLockExpires = "ufo:lock:expires"
+)
+
+// Lock is a deployment lock stored as tags on an ECS cluster. A lock past its expiry
+// is ignored so a crashed deploy can't block a cluster forever.
+type Lock struct {
+	ID      string
+	Holder  string
+	Commit  string
+	Expires time.Time
+}
+
+// NewLock creates a lock with a random ID held for ttl from now
+func NewLock(holder string, commit string, ttl time.Duration) *Lock {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &Lock{
+		ID:      hex.EncodeToString(id),
+		Holder:  holder,
+		Commit:  commit,
+		Expires: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+}
+
+// Expired returns true when the lock is past its expiry
+func (l *Lock) Expired() bool {
+	return time.Now().After(l.Expires)
+}
+
+// tags returns the ECS tags storing the lock on a cluster
+func (l *Lock) tags() []*ecs.Tag {
+	return []*ecs.Tag{
+		{Key: aws.String(tagLockID), Value: aws.String(l.ID)},
+		{Key: aws.String(tagLockHolder), Value: aws.String(l.Holder)},
+		{Key: aws.String(tagLockCommit), Value: aws.String(l.Commit)},
+		{Key: aws.String(tagLockExpires), Value: aws.String(l.Expires.Format(time.RFC3339))},
+	}
+}
+
+// lockFromTags reads a lock from the tags of a cluster
+func lockFromTags(tags []*ecs.Tag) *Lock {
+	lock := &Lock{}
+
+	for _, tag := range tags {
+		switch aws.StringValue(tag.Key) {
+		case tagLockID:
+			lock.ID = aws.StringValue(tag.Value)
+		case tagLockHolder:
+			lock.Holder = aws.StringValue(tag.Value)
+		case tagLockCommit:
+			lock.Commit = aws.StringValue(tag.Value)
+		case tagLockExpires:
+			// An unreadable expiry leaves the zero time, so the lock counts as expired
+			lock.Expires, _ = time.Parse(time.RFC3339, aws.StringValue(tag.Value))
+		}
+	}
+
+	if lock.ID == "" {
+		return nil
+	}
+
+	return lock
+}
+
+// GetLock returns the deployment lock of a cluster, or nil when the cluster is not locked
+func (u *UFO) GetLock(c *ecs.Cluster) (*Lock, error) {
+	return u.GetLockWithContext(aws.BackgroundContext(), c)
+}
+
+// GetLockWithContext is GetLock with a context to cancel its requests
+func (u *UFO) GetLockWithContext(ctx aws.Context, c *ecs.Cluster) (*Lock, error) {
+	result, err := u.ECS.ListTagsForResourceWithContext(ctx, &ecs.ListTagsForResourceInput{
+		ResourceArn: c.ClusterArn,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, errCouldNotRetrieveLock)
+	}
+
+	return lockFromTags(result.Tags), nil
+}
+
+// lockSettleTime is how long a lock is left on a cluster before it is read back, so a
+// concurrent deploy that read the cluster before it was tagged has time to overwrite it
+var lockSettleTime = time.Second * 3
+
+// AcquireLock locks a cluster unless it is locked by another lock that has not expired.
+// ECS tags can't be written conditionally, so the lock is best-effort: it is read back
+// lockSettleTime after tagging, and a deploy whose lock was overwritten in the meantime backs
+// off without touching the other lock. Two deploys that start within the settle time usually
+// end with one of them holding the lock, but that is not guaranteed.
+func (u *UFO) AcquireLock(c *ecs.Cluster, lock *Lock) error {
+	return u.AcquireLockWithContext(aws.BackgroundContext(), c, lock)
+}
+
+// AcquireLockWithContext is AcquireLock with a context to cancel its requests
+func (u *UFO) AcquireLockWithContext(ctx aws.Context, c *ecs.Cluster, lock *Lock) error {
+	current, err := u.GetLockWithContext(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if current != nil && current.ID != lock.ID && !current.Expired() {
+		return lockedError(current)
+	}
+
+	_, err = u.ECS.TagResourceWithContext(ctx, &ecs.TagResourceInput{
+		ResourceArn: c.ClusterArn,
+		Tags:        lock.tags(),
+	})
+
+	if err != nil {
+		return errors.Wrap(err, errCouldNotAcquireLock)
+	}
+
+	select {
+	case <-ctx.Done():
+		// The lock is released without the context, it was canceled
+		u.ReleaseLock(c, lock)
+		return errors.Wrap(ctx.Err(), errCouldNotAcquireLock)
+	case <-time.After(lockSettleTime):
+	}
+
+	current, err = u.GetLockWithContext(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	// Another deploy overwrote the lock, it holds the cluster now
+	if current == nil || current.ID != lock.ID {
+		return lockedError(current)
+	}
+
+	return nil
+}
+
+// ReleaseLock removes the lock of a cluster if it is still held by the given lock
+func (u *UFO) ReleaseLock(c *ecs.Cluster, lock *Lock) error {
+	return u.ReleaseLockWithContext(aws.BackgroundContext(), c, lock)
+}
+
+// ReleaseLockWithContext is ReleaseLock with a context to cancel its requests
+func (u *UFO) ReleaseLockWithContext(ctx aws.Context, c *ecs.Cluster, lock *Lock) error {
+	current, err := u.GetLockWithContext(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if current == nil || current.ID != lock.ID {
+		return nil
+	}
+
+	return u.ForceReleaseLockWithContext(ctx, c)
+}
+
+// ForceReleaseLock removes the lock of a cluster regardless of who holds it
+func (u *UFO) ForceReleaseLock(c *ecs.Cluster) error {
+	return u.ForceReleaseLockWithContext(aws.BackgroundContext(), c)
+}
+
+// ForceReleaseLockWithContext is ForceReleaseLock with a context to cancel its requests
+func (u *UFO) ForceReleaseLockWithContext(ctx aws.Context, c *ecs.Cluster) error {
+	_, err := u.ECS.UntagResourceWithContext(ctx, &ecs.UntagResourceInput{
+		ResourceArn: c.ClusterArn,
+		TagKeys:     aws.StringSlice([]string{tagLockID, tagLockHolder, tagLockCommit, tagLockExpires}),
+	})
+
+	if err != nil {
+		return errors.Wrap(err, errCouldNotReleaseLock)
+	}
+
+	return nil
+}
+
+func lockedError(lock *Lock) error {
+	if lock == nil {
+		return errors.New(errClusterLocked)
+	}
+
+	return errors.Errorf("%s by %s (commit %s) until %s", errClusterLocked, lock.Holder, lock.Commit, lock.Expires.Local().Format(time.RFC1123))
+}
@@ -0,0 +1,183 @@
+package ufo
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/pkg/errors"
+)
+
+// manifestMediaTypes are the manifest and manifest list media types requested from ECR
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// imageArchitectures maps the CPU architectures of an ECS runtime platform to the
+// architectures of image platforms
+var imageArchitectures = map[string]string{
+	ecs.CPUArchitectureX8664: "amd64",
+	ecs.CPUArchitectureArm64: "arm64",
+}
+
+// imageManifest is an image manifest or a manifest list of a multi-platform image
+type imageManifest struct {
+	Manifests []struct {
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+}
+
+// ImageArchitectures returns the CPU architectures an image in an ECR repo URL was built for,
+// e.g. amd64 and arm64. The architectures of a multi-platform image are read from its manifest
+// list, the architecture of a single image from its config.
+func (u *UFO) ImageArchitectures(repo string, tag string) ([]string, error) {
+	return u.ImageArchitecturesWithContext(aws.BackgroundContext(), repo, tag)
+}
+
+// ImageArchitecturesWithContext is ImageArchitectures with a context to cancel its requests
+func (u *UFO) ImageArchitecturesWithContext(ctx aws.Context, repo string, tag string) ([]string, error) {
+	registryID, repoName := parseRepo(repo)
+
+	input := &ecr.BatchGetImageInput{
+		RepositoryName:     aws.String(repoName),
+		AcceptedMediaTypes: aws.StringSlice(manifestMediaTypes),
+		ImageIds: []*ecr.ImageIdentifier{&ecr.ImageIdentifier{
+			ImageTag: aws.String(tag),
+		}},
+	}
+
+	if registryID != "" {
+		input.SetRegistryId(registryID)
+	}
+
+	result, err := u.ECR.BatchGetImageWithContext(ctx, input)
+
+	if err != nil {
+		return nil, errors.Wrap(err, errCouldNotRetrieveImages)
+	}
+
+	if len(result.Images) == 0 {
+		return nil, errors.Errorf("%s: %s:%s", errImageNotFound, repo, tag)
+	}
+
+	manifest := &imageManifest{}
+
+	if err := json.Unmarshal([]byte(aws.StringValue(result.Images[0].ImageManifest)), manifest); err != nil {
+		return nil, errors.Wrap(err, errCouldNotReadManifest)
+	}
+
+	if len(manifest.Manifests) == 0 {
+		arch, err := u.configArchitecture(ctx, registryID, repoName, manifest.Config.Digest)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{arch}, nil
+	}
+
+	architectures := []string{}
+
+	for _, m := range manifest.Manifests {
+		// Attestations of buildx are listed with an unknown platform
+		if m.Platform.Architecture != "" && m.Platform.Architecture != "unknown" {
+			architectures = append(architectures, m.Platform.Architecture)
+		}
+	}
+
+	return architectures, nil
+}
+
+// configArchitecture downloads the config of a single platform image and returns its
+// architecture
+func (u *UFO) configArchitecture(ctx aws.Context, registryID string, repoName string, digest string) (string, error) {
+	input := &ecr.GetDownloadUrlForLayerInput{
+		RepositoryName: aws.String(repoName),
+		LayerDigest:    aws.String(digest),
+	}
+
+	if registryID != "" {
+		input.SetRegistryId(registryID)
+	}
+
+	result, err := u.ECR.GetDownloadUrlForLayerWithContext(ctx, input)
+
+	if err != nil {
+		return "", errors.Wrap(err, errCouldNotReadManifest)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, aws.StringValue(result.DownloadUrl), nil)
+
+	if err != nil {
+		return "", errors.Wrap(err, errCouldNotReadManifest)
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return "", errors.Wrap(err, errCouldNotReadManifest)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("%s: %s", errCouldNotReadManifest, res.Status)
+	}
+
+	config := struct {
+		Architecture string `json:"architecture"`
+	}{}
+
+	if err := json.NewDecoder(res.Body).Decode(&config); err != nil {
+		return "", errors.Wrap(err, errCouldNotReadManifest)
+	}
+
+	return config.Architecture, nil
+}
+
+// platformCheck returns a function that checks that the image of a build detail was built
+// for the CPU architecture the runtime platform of a task definition requires. The
+// architectures of the image are only read once, and only for a task definition that
+// requires an architecture.
+func (u *UFO) platformCheck(ctx aws.Context, info BuildDetail) func(t *ecs.TaskDefinition) error {
+	var once sync.Once
+	var architectures []string
+	var err error
+
+	return func(t *ecs.TaskDefinition) error {
+		if t == nil || t.RuntimePlatform == nil || t.RuntimePlatform.CpuArchitecture == nil {
+			return nil
+		}
+
+		required := aws.StringValue(t.RuntimePlatform.CpuArchitecture)
+
+		once.Do(func() {
+			architectures, err = u.ImageArchitecturesWithContext(ctx, info.Repo, info.CommitHash)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, arch := range architectures {
+			if arch == imageArchitectures[required] {
+				return nil
+			}
+		}
+
+		return errors.Errorf("%s: the task needs %s, the image has %s", errImagePlatform, required, strings.Join(architectures, ", "))
+	}
+}
@@ -0,0 +1,227 @@
+package ufo
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/pkg/errors"
+)
+
+// ScanSeverities are the severities of scan findings from the most to the least severe
+var ScanSeverities = []string{
+	ecr.FindingSeverityCritical,
+	ecr.FindingSeverityHigh,
+	ecr.FindingSeverityMedium,
+	ecr.FindingSeverityLow,
+	ecr.FindingSeverityInformational,
+	ecr.FindingSeverityUndefined,
+}
+
+// scanWaitTime is the time between two requests for the findings of a scan in progress
+var scanWaitTime = time.Second * 5
+
+// scanNotFoundRetries is how often a scan that was not found is requested again, a scan on
+// push may not have started right after the push
+const scanNotFoundRetries = 3
+
+// ScanFinding is a vulnerability an image scan found. Name is the CVE ID of the finding.
+type ScanFinding struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	Package  string `json:"package,omitempty"`
+	URI      string `json:"uri,omitempty"`
+}
+
+// ScanResult holds the findings of a completed image scan and their number per severity
+type ScanResult struct {
+	Repo     string           `json:"repo"`
+	Tag      string           `json:"tag"`
+	Counts   map[string]int64 `json:"counts"`
+	Findings []*ScanFinding   `json:"findings"`
+}
+
+// Blocking returns the findings with a severity at or above the threshold severity, except
+// the findings whose CVE ID is in the allowlist
+func (r *ScanResult) Blocking(threshold string, allow []string) ([]*ScanFinding, error) {
+	if err := CheckSeverity(threshold); err != nil {
+		return nil, err
+	}
+
+	limit := severityRank(threshold)
+
+	allowed := map[string]bool{}
+	for _, name := range allow {
+		allowed[name] = true
+	}
+
+	blocking := []*ScanFinding{}
+
+	for _, finding := range r.Findings {
+		rank := severityRank(finding.Severity)
+
+		if rank >= 0 && rank <= limit && !allowed[finding.Name] {
+			blocking = append(blocking, finding)
+		}
+	}
+
+	return blocking, nil
+}
+
+// CheckSeverity returns an error unless a severity is one of ScanSeverities
+func CheckSeverity(severity string) error {
+	if severityRank(severity) < 0 {
+		return errors.Errorf("%s: %s", errUnknownSeverity, severity)
+	}
+
+	return nil
+}
+
+// severityRank returns the position of a severity in ScanSeverities, or -1 when it is unknown
+func severityRank(severity string) int {
+	for i, s := range ScanSeverities {
+		if s == severity {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ScanImage waits for the vulnerability scan of an image in an ECR repo URL to complete and
+// returns its findings. When start is true the scan is started first, otherwise the image
+// has to be scanned on push. A scan that ECR refuses to start because the image was scanned
+// recently is not an error, the findings of that scan are returned.
+func (u *UFO) ScanImage(repo string, tag string, start bool) (*ScanResult, error) {
+	return u.ScanImageWithContext(aws.BackgroundContext(), repo, tag, start)
+}
+
+// ScanImageWithContext is ScanImage with a context to cancel its requests
+func (u *UFO) ScanImageWithContext(ctx aws.Context, repo string, tag string, start bool) (*ScanResult, error) {
+	registryID, repoName := parseRepo(repo)
+	imageID := &ecr.ImageIdentifier{ImageTag: aws.String(tag)}
+
+	if start {
+		input := &ecr.StartImageScanInput{
+			RepositoryName: aws.String(repoName),
+			ImageId:        imageID,
+		}
+
+		if registryID != "" {
+			input.SetRegistryId(registryID)
+		}
+
+		_, err := u.ECR.StartImageScanWithContext(ctx, input)
+
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ecr.ErrCodeLimitExceededException {
+				return nil, errors.Wrap(err, errCouldNotScanImage)
+			}
+		}
+	}
+
+	result := &ScanResult{Repo: repo, Tag: tag, Counts: map[string]int64{}, Findings: []*ScanFinding{}}
+	notFound := 0
+
+	input := &ecr.DescribeImageScanFindingsInput{
+		RepositoryName: aws.String(repoName),
+		ImageId:        imageID,
+	}
+
+	if registryID != "" {
+		input.SetRegistryId(registryID)
+	}
+
+	for {
+		output, err := u.ECR.DescribeImageScanFindingsWithContext(ctx, input)
+
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+
+			if !ok || aerr.Code() != ecr.ErrCodeScanNotFoundException {
+				return nil, errors.Wrap(err, errCouldNotScanImage)
+			}
+
+			if notFound++; notFound > scanNotFoundRetries {
+				return nil, errors.Errorf("%s: %s:%s", errScanNotFound, repo, tag)
+			}
+		} else {
+			status := ""
+			description := ""
+
+			if output.ImageScanStatus != nil {
+				status = aws.StringValue(output.ImageScanStatus.Status)
+				description = aws.StringValue(output.ImageScanStatus.Description)
+			}
+
+			switch status {
+			case ecr.ScanStatusComplete, ecr.ScanStatusActive:
+				addFindings(result, output.ImageScanFindings)
+
+				if output.NextToken == nil {
+					return result, nil
+				}
+
+				// The next page is requested right away
+				input.SetNextToken(aws.StringValue(output.NextToken))
+				continue
+			case ecr.ScanStatusInProgress, ecr.ScanStatusPending:
+			default:
+				return nil, errors.Errorf("%s: %s %s", errScanFailed, status, description)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), errCouldNotScanImage)
+		case <-time.After(scanWaitTime):
+		}
+	}
+}
+
+// addFindings adds a page of basic or enhanced scan findings to a scan result. The counts
+// per severity are the same on every page.
+func addFindings(result *ScanResult, findings *ecr.ImageScanFindings) {
+	if findings == nil {
+		return
+	}
+
+	for severity, count := range findings.FindingSeverityCounts {
+		result.Counts[severity] = aws.Int64Value(count)
+	}
+
+	for _, f := range findings.Findings {
+		finding := &ScanFinding{
+			Name:     aws.StringValue(f.Name),
+			Severity: aws.StringValue(f.Severity),
+			URI:      aws.StringValue(f.Uri),
+		}
+
+		for _, attr := range f.Attributes {
+			if aws.StringValue(attr.Key) == "package_name" {
+				finding.Package = aws.StringValue(attr.Value)
+			}
+		}
+
+		result.Findings = append(result.Findings, finding)
+	}
+
+	for _, f := range findings.EnhancedFindings {
+		finding := &ScanFinding{
+			Name:     aws.StringValue(f.Title),
+			Severity: aws.StringValue(f.Severity),
+		}
+
+		if details := f.PackageVulnerabilityDetails; details != nil {
+			finding.Name = aws.StringValue(details.VulnerabilityId)
+			finding.URI = aws.StringValue(details.SourceUrl)
+
+			if len(details.VulnerablePackages) > 0 {
+				finding.Package = aws.StringValue(details.VulnerablePackages[0].Name)
+			}
+		}
+
+		result.Findings = append(result.Findings, finding)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/request"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
@@ -21,6 +22,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/fuzz-productions/ufo/pkg/docker"
 	"github.com/pkg/errors"
 )
 
@@ -30,10 +32,11 @@ type AwsConfig struct {
 }
 
 type UFO struct {
-	Config *AwsConfig
-	ECS    ecsiface.ECSAPI
-	ECR    ecriface.ECRAPI
-	CWL    cloudwatchlogsiface.CloudWatchLogsAPI
+	Config   *AwsConfig
+	ECS      ecsiface.ECSAPI
+	ECR      ecriface.ECRAPI
+	CWL      cloudwatchlogsiface.CloudWatchLogsAPI
+	Reporter Reporter
 }
 
 // New creates a UFO session and connects to AWS to create a session
@@ -61,7 +64,12 @@ func New(awsConfig *AwsConfig) *UFO {
 
 // Clusters returns all ECS clusters
 func (u *UFO) Clusters() ([]string, error) {
-	res, err := u.ECS.ListClusters(&ecs.ListClustersInput{})
+	return u.ClustersWithContext(aws.BackgroundContext())
+}
+
+// ClustersWithContext is Clusters with a context to cancel its requests
+func (u *UFO) ClustersWithContext(ctx aws.Context) ([]string, error) {
+	res, err := u.ECS.ListClustersWithContext(ctx, &ecs.ListClustersInput{})
 
 	if err != nil {
 		return nil, errors.Wrap(err, errFailedToListClusters)
@@ -80,7 +88,12 @@ func (u *UFO) Clusters() ([]string, error) {
 
 // Services returns all services in a cluster
 func (u *UFO) Services(c *ecs.Cluster) ([]string, error) {
-	res, err := u.ECS.ListServices(&ecs.ListServicesInput{
+	return u.ServicesWithContext(aws.BackgroundContext(), c)
+}
+
+// ServicesWithContext is Services with a context to cancel its requests
+func (u *UFO) ServicesWithContext(ctx aws.Context, c *ecs.Cluster) ([]string, error) {
+	res, err := u.ECS.ListServicesWithContext(ctx, &ecs.ListServicesInput{
 		Cluster: c.ClusterArn,
 	})
 
@@ -100,7 +113,12 @@ func (u *UFO) Services(c *ecs.Cluster) ([]string, error) {
 
 // RunningTasks gets all running tasks in a cluster and service
 func (u *UFO) RunningTasks(c *ecs.Cluster, s *ecs.Service) ([]*string, error) {
-	result, err := u.ECS.ListTasks(&ecs.ListTasksInput{
+	return u.RunningTasksWithContext(aws.BackgroundContext(), c, s)
+}
+
+// RunningTasksWithContext is RunningTasks with a context to cancel its requests
+func (u *UFO) RunningTasksWithContext(ctx aws.Context, c *ecs.Cluster, s *ecs.Service) ([]*string, error) {
+	result, err := u.ECS.ListTasksWithContext(ctx, &ecs.ListTasksInput{
 		Cluster:       c.ClusterName,
 		ServiceName:   s.ServiceName,
 		DesiredStatus: aws.String("RUNNING"),
@@ -115,7 +133,12 @@ func (u *UFO) RunningTasks(c *ecs.Cluster, s *ecs.Service) ([]*string, error) {
 
 // GetCluster returns a clusters detail
 func (u *UFO) GetCluster(name string) (*ecs.Cluster, error) {
-	res, err := u.ECS.DescribeClusters(&ecs.DescribeClustersInput{
+	return u.GetClusterWithContext(aws.BackgroundContext(), name)
+}
+
+// GetClusterWithContext is GetCluster with a context to cancel its requests
+func (u *UFO) GetClusterWithContext(ctx aws.Context, name string) (*ecs.Cluster, error) {
+	res, err := u.ECS.DescribeClustersWithContext(ctx, &ecs.DescribeClustersInput{
 		Clusters: []*string{
 			&name,
 		},
@@ -134,7 +157,12 @@ func (u *UFO) GetCluster(name string) (*ecs.Cluster, error) {
 
 // GetService returns service details within a cluster by service name or ARN
 func (u *UFO) GetService(c *ecs.Cluster, service string) (*ecs.Service, error) {
-	res, err := u.ECS.DescribeServices(&ecs.DescribeServicesInput{
+	return u.GetServiceWithContext(aws.BackgroundContext(), c, service)
+}
+
+// GetServiceWithContext is GetService with a context to cancel its requests
+func (u *UFO) GetServiceWithContext(ctx aws.Context, c *ecs.Cluster, service string) (*ecs.Service, error) {
+	res, err := u.ECS.DescribeServicesWithContext(ctx, &ecs.DescribeServicesInput{
 		Cluster: c.ClusterArn,
 		Services: []*string{
 			&service,
@@ -155,7 +183,12 @@ func (u *UFO) GetService(c *ecs.Cluster, service string) (*ecs.Service, error) {
 // GetTaskDefinition returns details of a task definition in
 // a cluster and service by service's current task definition
 func (u *UFO) GetTaskDefinition(c *ecs.Cluster, s *ecs.Service) (*ecs.TaskDefinition, error) {
-	result, err := u.ECS.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+	return u.GetTaskDefinitionWithContext(aws.BackgroundContext(), c, s)
+}
+
+// GetTaskDefinitionWithContext is GetTaskDefinition with a context to cancel its requests
+func (u *UFO) GetTaskDefinitionWithContext(ctx aws.Context, c *ecs.Cluster, s *ecs.Service) (*ecs.TaskDefinition, error) {
+	result, err := u.ECS.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
 		TaskDefinition: s.TaskDefinition,
 	})
 
@@ -168,7 +201,12 @@ func (u *UFO) GetTaskDefinition(c *ecs.Cluster, s *ecs.Service) (*ecs.TaskDefini
 
 // GetTasks gets all tasks in a cluster
 func (u *UFO) GetTasks(c *ecs.Cluster, tasks []*string) ([]*ecs.Task, error) {
-	result, err := u.ECS.DescribeTasks(&ecs.DescribeTasksInput{
+	return u.GetTasksWithContext(aws.BackgroundContext(), c, tasks)
+}
+
+// GetTasksWithContext is GetTasks with a context to cancel its requests
+func (u *UFO) GetTasksWithContext(ctx aws.Context, c *ecs.Cluster, tasks []*string) ([]*ecs.Task, error) {
+	result, err := u.ECS.DescribeTasksWithContext(ctx, &ecs.DescribeTasksInput{
 		Cluster: c.ClusterName,
 		Tasks:   tasks,
 	})
@@ -180,15 +218,23 @@ func (u *UFO) GetTasks(c *ecs.Cluster, tasks []*string) ([]*ecs.Task, error) {
 	return result.Tasks, nil
 }
 
-// GetImages gets images for a task definition
-// @todo how does this handle multiple images in a task def?
+// GetImages gets images for the first container of a task definition
 func (u *UFO) GetImages(t *ecs.TaskDefinition) ([]*ecr.ImageDetail, error) {
-	currentImage := t.ContainerDefinitions[0].Image
+	return u.GetImagesWithContext(aws.BackgroundContext(), t)
+}
+
+// GetImagesWithContext is GetImages with a context to cancel its requests
+func (u *UFO) GetImagesWithContext(ctx aws.Context, t *ecs.TaskDefinition) ([]*ecr.ImageDetail, error) {
+	container, err := containerDefinition(t, "")
+
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse the repo name out of an image tag
-	repoName := u.GetRepoFromImage(currentImage)
+	repoName := u.GetRepoFromImage(container.Image)
 
-	result, err := u.ECR.DescribeImages(&ecr.DescribeImagesInput{
+	result, err := u.ECR.DescribeImagesWithContext(ctx, &ecr.DescribeImagesInput{
 		RepositoryName: aws.String(repoName),
 	})
 
@@ -207,9 +253,123 @@ func (u *UFO) GetImages(t *ecs.TaskDefinition) ([]*ecr.ImageDetail, error) {
 	return images, nil
 }
 
-// GetLastDeployedCommit finds the most recent committed image for a taskDefinition
+// ImageExists checks if an image with the given tag exists in an ECR repo URL
+func (u *UFO) ImageExists(repo string, tag string) (bool, error) {
+	return u.ImageExistsWithContext(aws.BackgroundContext(), repo, tag)
+}
+
+// ImageExistsWithContext is ImageExists with a context to cancel its requests
+func (u *UFO) ImageExistsWithContext(ctx aws.Context, repo string, tag string) (bool, error) {
+	registryID, repoName := parseRepo(repo)
+
+	input := &ecr.DescribeImagesInput{
+		RepositoryName: aws.String(repoName),
+		ImageIds: []*ecr.ImageIdentifier{&ecr.ImageIdentifier{
+			ImageTag: aws.String(tag),
+		}},
+	}
+
+	if registryID != "" {
+		input.SetRegistryId(registryID)
+	}
+
+	result, err := u.ECR.DescribeImagesWithContext(ctx, input)
+
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ecr.ErrCodeImageNotFoundException {
+			return false, nil
+		}
+
+		return false, errors.Wrap(err, errCouldNotRetrieveImages)
+	}
+
+	return len(result.ImageDetails) > 0, nil
+}
+
+// TagImage adds tags to an image that already exists in an ECR repo URL, moving tags that
+// point to another image. The image is not pulled, its manifest is put again with each tag.
+func (u *UFO) TagImage(repo string, tag string, tags []string) error {
+	return u.TagImageWithContext(aws.BackgroundContext(), repo, tag, tags)
+}
+
+// TagImageWithContext is TagImage with a context to cancel its requests
+func (u *UFO) TagImageWithContext(ctx aws.Context, repo string, tag string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	registryID, repoName := parseRepo(repo)
+
+	input := &ecr.BatchGetImageInput{
+		RepositoryName: aws.String(repoName),
+		ImageIds: []*ecr.ImageIdentifier{&ecr.ImageIdentifier{
+			ImageTag: aws.String(tag),
+		}},
+	}
+
+	if registryID != "" {
+		input.SetRegistryId(registryID)
+	}
+
+	result, err := u.ECR.BatchGetImageWithContext(ctx, input)
+
+	if err != nil {
+		return errors.Wrap(err, errCouldNotRetrieveImages)
+	}
+
+	if len(result.Images) == 0 {
+		return errors.Errorf("%s: %s:%s", errImageNotFound, repo, tag)
+	}
+
+	image := result.Images[0]
+
+	for _, t := range tags {
+		put := &ecr.PutImageInput{
+			RepositoryName:         aws.String(repoName),
+			ImageManifest:          image.ImageManifest,
+			ImageManifestMediaType: image.ImageManifestMediaType,
+			ImageTag:               aws.String(t),
+		}
+
+		if registryID != "" {
+			put.SetRegistryId(registryID)
+		}
+
+		_, err := u.ECR.PutImageWithContext(ctx, put)
+
+		// The tag already points to the image
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ecr.ErrCodeImageAlreadyExistsException {
+			continue
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "%s %s", errCouldNotTagImage, t)
+		}
+	}
+
+	return nil
+}
+
+// GetLastDeployedCommit finds the image tag of the first container in a taskDefinition, see
+// GetLastDeployedCommitForContainer for the other containers
 func (u *UFO) GetLastDeployedCommit(taskDefinition string) (string, error) {
-	result, err := u.ECS.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+	return u.GetLastDeployedCommitWithContext(aws.BackgroundContext(), taskDefinition)
+}
+
+// GetLastDeployedCommitWithContext is GetLastDeployedCommit with a context to cancel its requests
+func (u *UFO) GetLastDeployedCommitWithContext(ctx aws.Context, taskDefinition string) (string, error) {
+	return u.GetLastDeployedCommitForContainerWithContext(ctx, taskDefinition, "")
+}
+
+// GetLastDeployedCommitForContainer finds the image tag of a named container in a taskDefinition.
+// An empty name selects the first container.
+func (u *UFO) GetLastDeployedCommitForContainer(taskDefinition string, name string) (string, error) {
+	return u.GetLastDeployedCommitForContainerWithContext(aws.BackgroundContext(), taskDefinition, name)
+}
+
+// GetLastDeployedCommitForContainerWithContext is GetLastDeployedCommitForContainer with a context to cancel its requests
+func (u *UFO) GetLastDeployedCommitForContainerWithContext(ctx aws.Context, taskDefinition string, name string) (string, error) {
+	result, err := u.ECS.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
 		TaskDefinition: &taskDefinition,
 	})
 
@@ -217,52 +377,61 @@ func (u *UFO) GetLastDeployedCommit(taskDefinition string) (string, error) {
 		return "", errors.Wrap(err, errCouldNotRetrieveTaskDefinition)
 	}
 
-	if len(result.TaskDefinition.ContainerDefinitions) < 1 {
-		return "", errors.Wrap(err, errInvalidTaskDefinition)
+	container, err := containerDefinition(result.TaskDefinition, name)
+
+	if err != nil {
+		return "", err
 	}
 
-	repo := result.TaskDefinition.ContainerDefinitions[0].Image
+	tag := imageTag(aws.StringValue(container.Image))
 
-	r := regexp.MustCompile(`\:(\S+)`)
+	if tag == "" {
+		return "", errors.New(errImageHasNoTag)
+	}
 
-	return r.FindStringSubmatch(*repo)[1], nil
+	return tag, nil
 }
 
 // RegisterTaskDefinitionWithImage creates a new task definition with the provided tag
 // This copies an existing task definition and only changes the tag used for the image
-func (u *UFO) RegisterTaskDefinitionWithImage(c *ecs.Cluster, s *ecs.Service, tag string) (*ecs.TaskDefinition, error) {
-	t, err := u.GetTaskDefinition(c, s)
+// of the containers named in repos, see UpdateTaskDefinitionImage
+func (u *UFO) RegisterTaskDefinitionWithImage(c *ecs.Cluster, s *ecs.Service, tag string, repos map[string]string, op *Operation) (*ecs.TaskDefinition, error) {
+	return u.RegisterTaskDefinitionWithImageWithContext(aws.BackgroundContext(), c, s, tag, repos, op)
+}
+
+// RegisterTaskDefinitionWithImageWithContext is RegisterTaskDefinitionWithImage with a context to cancel its requests
+func (u *UFO) RegisterTaskDefinitionWithImageWithContext(ctx aws.Context, c *ecs.Cluster, s *ecs.Service, tag string, repos map[string]string, op *Operation) (*ecs.TaskDefinition, error) {
+	t, err := u.GetTaskDefinitionWithContext(ctx, c, s)
 
 	if err != nil {
 		return nil, err
 	}
 
-	newTaskDef := u.UpdateTaskDefinitionImage(*t, tag)
-
-	result, err := u.ECS.RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
-		// Update the task definition to use the new docker image via UpdateTaskDefinitionImage
-		Cpu:                     newTaskDef.Cpu,
-		Family:                  newTaskDef.Family,
-		Memory:                  newTaskDef.Memory,
-		Volumes:                 newTaskDef.Volumes,
-		NetworkMode:             newTaskDef.NetworkMode,
-		ExecutionRoleArn:        newTaskDef.ExecutionRoleArn,
-		TaskRoleArn:             newTaskDef.TaskRoleArn,
-		ContainerDefinitions:    newTaskDef.ContainerDefinitions,
-		RequiresCompatibilities: newTaskDef.RequiresCompatibilities,
-	})
+	newTaskDef, err := u.UpdateTaskDefinitionImage(*t, tag, repos)
 
 	if err != nil {
-		return nil, errors.Wrap(err, errCouldNotRegisterTaskDefinition)
+		return nil, err
 	}
 
-	return result.TaskDefinition, nil
+	// Update the task definition to use the new docker image via UpdateTaskDefinitionImage
+	return u.registerTaskDefinition(ctx, &newTaskDef, op)
 }
 
 // RegisterTaskDefinitionWithEnvVars takes a task definition as an argument and updates its
 // ContainerDefinitions field which contains environment variables
-func (u *UFO) RegisterTaskDefinitionWithEnvVars(t *ecs.TaskDefinition) (*ecs.TaskDefinition, error) {
-	result, err := u.ECS.RegisterTaskDefinition(&ecs.RegisterTaskDefinitionInput{
+func (u *UFO) RegisterTaskDefinitionWithEnvVars(t *ecs.TaskDefinition, op *Operation) (*ecs.TaskDefinition, error) {
+	return u.RegisterTaskDefinitionWithEnvVarsWithContext(aws.BackgroundContext(), t, op)
+}
+
+// RegisterTaskDefinitionWithEnvVarsWithContext is RegisterTaskDefinitionWithEnvVars with a context to cancel its requests
+func (u *UFO) RegisterTaskDefinitionWithEnvVarsWithContext(ctx aws.Context, t *ecs.TaskDefinition, op *Operation) (*ecs.TaskDefinition, error) {
+	return u.registerTaskDefinition(ctx, t, op)
+}
+
+// registerTaskDefinition registers a copy of a task definition as a new revision of its family
+// and tags it with the operation that registered it
+func (u *UFO) registerTaskDefinition(ctx aws.Context, t *ecs.TaskDefinition, op *Operation) (*ecs.TaskDefinition, error) {
+	result, err := u.ECS.RegisterTaskDefinitionWithContext(ctx, &ecs.RegisterTaskDefinitionInput{
 		Cpu:                     t.Cpu,
 		Family:                  t.Family,
 		Memory:                  t.Memory,
@@ -272,6 +441,14 @@ func (u *UFO) RegisterTaskDefinitionWithEnvVars(t *ecs.TaskDefinition) (*ecs.Tas
 		TaskRoleArn:             t.TaskRoleArn,
 		ContainerDefinitions:    t.ContainerDefinitions,
 		RequiresCompatibilities: t.RequiresCompatibilities,
+		EphemeralStorage:        t.EphemeralStorage,
+		InferenceAccelerators:   t.InferenceAccelerators,
+		IpcMode:                 t.IpcMode,
+		PidMode:                 t.PidMode,
+		PlacementConstraints:    t.PlacementConstraints,
+		ProxyConfiguration:      t.ProxyConfiguration,
+		RuntimePlatform:         t.RuntimePlatform,
+		Tags:                    op.Tags(),
 	})
 
 	if err != nil {
@@ -281,17 +458,30 @@ func (u *UFO) RegisterTaskDefinitionWithEnvVars(t *ecs.TaskDefinition) (*ecs.Tas
 	return result.TaskDefinition, nil
 }
 
-// RollbackTaskDefinition updates the task definition to the desired revision number
-func (u *UFO) RollbackTaskDefinition(c *ecs.Cluster, s *ecs.Service, t *ecs.TaskDefinition, n int) (string, error) {
+// RollbackTaskDefinition updates the service to the desired revision number, or the revision
+// before the current one when n is 0. The desired revision is tagged with the rollback
+// operation and the revision it replaced, so it shows up as rolled back to in the history of
+// the family. The task definition t is not modified.
+func (u *UFO) RollbackTaskDefinition(c *ecs.Cluster, s *ecs.Service, t *ecs.TaskDefinition, n int, op *Operation) (string, error) {
+	return u.RollbackTaskDefinitionWithContext(aws.BackgroundContext(), c, s, t, n, op)
+}
+
+// RollbackTaskDefinitionWithContext is RollbackTaskDefinition with a context to cancel its requests
+func (u *UFO) RollbackTaskDefinitionWithContext(ctx aws.Context, c *ecs.Cluster, s *ecs.Service, t *ecs.TaskDefinition, n int, op *Operation) (string, error) {
+	_, taskFamilyRevision, err := u.rollbackTaskDefinition(ctx, c, s, t, n, op)
 
+	return taskFamilyRevision, err
+}
+
+// rollbackTaskDefinition is RollbackTaskDefinition and also returns the task definition the
+// service was rolled back to
+func (u *UFO) rollbackTaskDefinition(ctx aws.Context, c *ecs.Cluster, s *ecs.Service, t *ecs.TaskDefinition, n int, op *Operation) (*ecs.TaskDefinition, string, error) {
 	var taskFamilyRevision string
 
 	r := regexp.MustCompile(`([^\/]+)$`)
-	x := regexp.MustCompile(`([^\/]+)`)
 
 	currentTaskDefinitionArn := *t.TaskDefinitionArn
 	currentTaskDefinitionFamilyRevision := r.FindString(currentTaskDefinitionArn)
-	currentTaskDefinitionArnName := x.FindString(currentTaskDefinitionArn)
 	split := strings.Split(currentTaskDefinitionFamilyRevision, ":")
 	taskFamily, taskRevision := split[0], split[1]
 
@@ -303,24 +493,81 @@ func (u *UFO) RollbackTaskDefinition(c *ecs.Cluster, s *ecs.Service, t *ecs.Task
 		taskFamilyRevision = strings.Join([]string{taskFamily, ":", strconv.Itoa(i)}, "")
 	}
 
-	taskFamilyRevisionArn := currentTaskDefinitionArnName + "/" + taskFamilyRevision
-	*t.TaskDefinitionArn = taskFamilyRevisionArn
-	_, err := u.RollbackService(c, s, taskFamilyRevision)
+	target, err := u.ECS.DescribeTaskDefinitionWithContext(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(taskFamilyRevision),
+	})
 
-	return taskFamilyRevision, err
+	if err != nil {
+		return nil, taskFamilyRevision, errors.Wrap(err, errCouldNotRetrieveTaskDefinition)
+	}
+
+	_, err = u.RollbackServiceWithContext(ctx, c, s, *target.TaskDefinition.TaskDefinitionArn)
+
+	if err != nil {
+		return target.TaskDefinition, taskFamilyRevision, err
+	}
+
+	rollbackOp := &Operation{Type: OperationRollback, Source: currentTaskDefinitionFamilyRevision}
+
+	if op != nil {
+		rollbackOp.Deployer = op.Deployer
+	}
+
+	// The rollback is recorded after the service is updated so a missing permission to tag
+	// task definitions never blocks it
+	_, err = u.ECS.TagResourceWithContext(ctx, &ecs.TagResourceInput{
+		ResourceArn: target.TaskDefinition.TaskDefinitionArn,
+		Tags:        rollbackOp.RollbackTags(),
+	})
+
+	if err != nil {
+		u.Report(&Event{
+			Type:           EventWarning,
+			Cluster:        aws.StringValue(c.ClusterName),
+			Service:        aws.StringValue(s.ServiceName),
+			TaskDefinition: taskFamilyRevision,
+			Error:          errors.Wrap(err, errCouldNotTagTaskDefinition).Error(),
+		})
+	}
+
+	return target.TaskDefinition, taskFamilyRevision, nil
 }
 
-// UpdateTaskDefinitionImage copies a task definition and update its image tag
-func (u *UFO) UpdateTaskDefinitionImage(t ecs.TaskDefinition, tag string) ecs.TaskDefinition {
-	r := regexp.MustCompile(`(\S+):`)
-	currentImage := *t.ContainerDefinitions[0].Image
+// UpdateTaskDefinitionImage copies a task definition and update its image tag.
+// When repos is empty only the first container is updated. Otherwise every container
+// named in repos is updated and all other containers are left untouched. A container
+// mapped to an empty repo keeps the repo of its current image.
+func (u *UFO) UpdateTaskDefinitionImage(t ecs.TaskDefinition, tag string, repos map[string]string) (ecs.TaskDefinition, error) {
+	// Deep copy so the container definitions of the original are not modified
+	t = *awsutil.CopyOf(&t).(*ecs.TaskDefinition)
+
+	if len(repos) == 0 {
+		container, err := containerDefinition(&t, "")
+
+		if err != nil {
+			return t, err
+		}
+
+		container.Image = aws.String(fmt.Sprintf("%s:%s", imageRepo(*container.Image), tag))
+
+		return t, nil
+	}
+
+	for name, repo := range repos {
+		container, err := containerDefinition(&t, name)
+
+		if err != nil {
+			return t, err
+		}
 
-	repo := r.FindStringSubmatch(currentImage)[1]
-	newImage := fmt.Sprintf("%s:%s", repo, tag)
+		if repo == "" {
+			repo = imageRepo(*container.Image)
+		}
 
-	*t.ContainerDefinitions[0].Image = newImage
+		container.Image = aws.String(fmt.Sprintf("%s:%s", repo, tag))
+	}
 
-	return t
+	return t, nil
 }
 
 // GetRepoFromImage parses an image URL:tag and reads its repo
@@ -332,9 +579,70 @@ func (u *UFO) GetRepoFromImage(image *string) string {
 	return repo
 }
 
+// containerDefinition finds a container definition in a task definition by name.
+// An empty name returns the first container definition.
+func containerDefinition(t *ecs.TaskDefinition, name string) (*ecs.ContainerDefinition, error) {
+	if len(t.ContainerDefinitions) < 1 {
+		return nil, errors.New(errInvalidTaskDefinition)
+	}
+
+	if name == "" {
+		return t.ContainerDefinitions[0], nil
+	}
+
+	for _, container := range t.ContainerDefinitions {
+		if aws.StringValue(container.Name) == name {
+			return container, nil
+		}
+	}
+
+	return nil, errors.Errorf("%s: %s", errContainerNotFound, name)
+}
+
+// parseRepo splits an ECR repo URL into its registry ID and repository name
+// e.g. 111222333444.dkr.ecr.us-west-1.amazonaws.com/image
+func parseRepo(repo string) (string, string) {
+	split := strings.SplitN(imageRepo(repo), "/", 2)
+
+	if len(split) < 2 {
+		return "", split[0]
+	}
+
+	r := regexp.MustCompile(`^(\d{12})\.dkr\.ecr\.`)
+
+	if match := r.FindStringSubmatch(split[0]); match != nil {
+		return match[1], split[1]
+	}
+
+	return "", split[1]
+}
+
+// imageRepo strips the tag from an image URL:tag
+func imageRepo(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+
+	return image
+}
+
+// imageTag returns the tag of an image URL:tag or an empty string if it has none
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+
+	return ""
+}
+
 // RollbackService updates the ECS service with the desired rollback revision
 func (u *UFO) RollbackService(c *ecs.Cluster, s *ecs.Service, t string) (*ecs.UpdateServiceOutput, error) {
-	result, err := u.ECS.UpdateService(&ecs.UpdateServiceInput{
+	return u.RollbackServiceWithContext(aws.BackgroundContext(), c, s, t)
+}
+
+// RollbackServiceWithContext is RollbackService with a context to cancel its requests
+func (u *UFO) RollbackServiceWithContext(ctx aws.Context, c *ecs.Cluster, s *ecs.Service, t string) (*ecs.UpdateServiceOutput, error) {
+	result, err := u.ECS.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
 		Cluster:        c.ClusterArn,
 		Service:        s.ServiceArn,
 		TaskDefinition: aws.String(t),
@@ -349,7 +657,12 @@ func (u *UFO) RollbackService(c *ecs.Cluster, s *ecs.Service, t string) (*ecs.Up
 
 // UpdateService updates a service in a cluster with a new task definition
 func (u *UFO) UpdateService(c *ecs.Cluster, s *ecs.Service, t *ecs.TaskDefinition) (*ecs.UpdateServiceOutput, error) {
-	result, err := u.ECS.UpdateService(&ecs.UpdateServiceInput{
+	return u.UpdateServiceWithContext(aws.BackgroundContext(), c, s, t)
+}
+
+// UpdateServiceWithContext is UpdateService with a context to cancel its requests
+func (u *UFO) UpdateServiceWithContext(ctx aws.Context, c *ecs.Cluster, s *ecs.Service, t *ecs.TaskDefinition) (*ecs.UpdateServiceOutput, error) {
+	result, err := u.ECS.UpdateServiceWithContext(ctx, &ecs.UpdateServiceInput{
 		Cluster:        c.ClusterArn,
 		Service:        s.ServiceArn,
 		TaskDefinition: t.TaskDefinitionArn,
@@ -364,14 +677,19 @@ func (u *UFO) UpdateService(c *ecs.Cluster, s *ecs.Service, t *ecs.TaskDefinitio
 
 // UpdateServiceWithNewTaskDefinition registers a task definition with a tag and updates a service
 // with the newly registered task definition
-func (u *UFO) UpdateServiceWithNewTaskDefinition(c *ecs.Cluster, s *ecs.Service, tag string) (*ecs.TaskDefinition, error) {
-	t, err := u.RegisterTaskDefinitionWithImage(c, s, tag)
+func (u *UFO) UpdateServiceWithNewTaskDefinition(c *ecs.Cluster, s *ecs.Service, tag string, repos map[string]string, op *Operation) (*ecs.TaskDefinition, error) {
+	return u.UpdateServiceWithNewTaskDefinitionWithContext(aws.BackgroundContext(), c, s, tag, repos, op)
+}
+
+// UpdateServiceWithNewTaskDefinitionWithContext is UpdateServiceWithNewTaskDefinition with a context to cancel its requests
+func (u *UFO) UpdateServiceWithNewTaskDefinitionWithContext(ctx aws.Context, c *ecs.Cluster, s *ecs.Service, tag string, repos map[string]string, op *Operation) (*ecs.TaskDefinition, error) {
+	t, err := u.RegisterTaskDefinitionWithImageWithContext(ctx, c, s, tag, repos, op)
 
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = u.UpdateService(c, s, t)
+	_, err = u.UpdateServiceWithContext(ctx, c, s, t)
 
 	if err != nil {
 		return nil, err
@@ -380,17 +698,39 @@ func (u *UFO) UpdateServiceWithNewTaskDefinition(c *ecs.Cluster, s *ecs.Service,
 	return t, err
 }
 
-// RunTask runs a specified task in a cluster
+// RunTask runs a specified task in a cluster with the command of its first container
 func (u *UFO) RunTask(c *ecs.Cluster, t *ecs.TaskDefinition, cmd string) (*ecs.RunTaskOutput, error) {
+	return u.RunTaskWithContext(aws.BackgroundContext(), c, t, cmd)
+}
+
+// RunTaskWithContext is RunTask with a context to cancel its requests
+func (u *UFO) RunTaskWithContext(ctx aws.Context, c *ecs.Cluster, t *ecs.TaskDefinition, cmd string) (*ecs.RunTaskOutput, error) {
+	return u.RunTaskInContainerWithContext(ctx, c, t, "", cmd)
+}
+
+// RunTaskInContainer runs a specified task in a cluster with the command of a named container.
+// An empty name selects the first container.
+func (u *UFO) RunTaskInContainer(c *ecs.Cluster, t *ecs.TaskDefinition, name string, cmd string) (*ecs.RunTaskOutput, error) {
+	return u.RunTaskInContainerWithContext(aws.BackgroundContext(), c, t, name, cmd)
+}
+
+// RunTaskInContainerWithContext is RunTaskInContainer with a context to cancel its requests
+func (u *UFO) RunTaskInContainerWithContext(ctx aws.Context, c *ecs.Cluster, t *ecs.TaskDefinition, name string, cmd string) (*ecs.RunTaskOutput, error) {
+	container, err := containerDefinition(t, name)
+
+	if err != nil {
+		return nil, err
+	}
+
 	splitString := strings.Split(cmd, " ")
 
-	result, err := u.ECS.RunTask(&ecs.RunTaskInput{
+	result, err := u.ECS.RunTaskWithContext(ctx, &ecs.RunTaskInput{
 		Cluster:        c.ClusterName,
 		TaskDefinition: t.TaskDefinitionArn,
 		Overrides: &ecs.TaskOverride{
 			ContainerOverrides: []*ecs.ContainerOverride{&ecs.ContainerOverride{
 				Command: aws.StringSlice(splitString),
-				Name:    t.ContainerDefinitions[0].Name,
+				Name:    container.Name,
 			}},
 		},
 	})
@@ -399,94 +739,191 @@ func (u *UFO) RunTask(c *ecs.Cluster, t *ecs.TaskDefinition, cmd string) (*ecs.R
 		return nil, errors.Wrap(err, errCouldNotRunTask)
 	}
 
+	// ECS reports why no task was started, e.g. a lack of resources, as failures
+	if len(result.Tasks) == 0 {
+		reasons := []string{}
+
+		for _, failure := range result.Failures {
+			reasons = append(reasons, fmt.Sprintf("%s (%s)", aws.StringValue(failure.Reason), aws.StringValue(failure.Detail)))
+		}
+
+		return nil, errors.Errorf("%s: %s", errTaskNotStarted, strings.Join(reasons, ", "))
+	}
+
 	return result, nil
 }
 
-// IsServiceRunning is meant to be called after a service update. This function checks if the newly
-// started task has the status "RUNNING"
-func (u *UFO) IsServiceRunning(detail *DeployDetail) bool {
-	if *detail.Service.DesiredCount <= 0 {
+// ServiceProgress is the rollout of a deploy detail's task definition to its service.
+// Draining counts the tasks of the service's other deployments that are still running.
+type ServiceProgress struct {
+	Desired      int64  `json:"desired"`
+	Running      int64  `json:"running"`
+	Pending      int64  `json:"pending"`
+	Draining     int64  `json:"draining"`
+	Deployments  int    `json:"deployments"`
+	Primary      bool   `json:"primary"`
+	RolloutState string `json:"rolloutState,omitempty"`
+}
+
+// Stable returns true when the task definition is the service's primary deployment with
+// every desired task running and all other deployments are drained. The rollout state is
+// only checked when ECS reports one, e.g. services with the circuit breaker enabled.
+func (p *ServiceProgress) Stable() bool {
+	if !p.Primary || p.Running != p.Desired || p.Pending > 0 || p.Deployments > 1 {
 		return false
 	}
 
-	runningTasks, err := u.RunningTasks(detail.Cluster, detail.Service)
+	return p.RolloutState == "" || p.RolloutState == ecs.DeploymentRolloutStateCompleted
+}
 
-	if err != nil {
-		return false
-	}
+// Failed returns true when ECS reports the rollout of the task definition as failed
+func (p *ServiceProgress) Failed() bool {
+	return p.RolloutState == ecs.DeploymentRolloutStateFailed
+}
 
-	if len(runningTasks) <= 0 {
-		return false
-	}
+// GetServiceProgress is meant to be called after a service update. It returns the progress of
+// the rollout of the deploy detail's task definition from the service's deployments.
+func (u *UFO) GetServiceProgress(detail *DeployDetail) (*ServiceProgress, error) {
+	return u.GetServiceProgressWithContext(aws.BackgroundContext(), detail)
+}
 
-	tasks, err := u.GetTasks(detail.Cluster, runningTasks)
+// GetServiceProgressWithContext is GetServiceProgress with a context to cancel its requests
+func (u *UFO) GetServiceProgressWithContext(ctx aws.Context, detail *DeployDetail) (*ServiceProgress, error) {
+	s, err := u.GetServiceWithContext(ctx, detail.Cluster, *detail.Service.ServiceArn)
 
 	if err != nil {
-		return false
+		return nil, err
 	}
 
-	for _, task := range tasks {
-		if *task.TaskDefinitionArn == *detail.TaskDefinition.TaskDefinitionArn && *task.LastStatus == "RUNNING" {
-			return true
+	progress := &ServiceProgress{
+		Desired:     aws.Int64Value(s.DesiredCount),
+		Deployments: len(s.Deployments),
+	}
+
+	for _, deployment := range s.Deployments {
+		if aws.StringValue(deployment.TaskDefinition) != aws.StringValue(detail.TaskDefinition.TaskDefinitionArn) {
+			progress.Draining += aws.Int64Value(deployment.RunningCount)
+			continue
 		}
+
+		progress.Desired = aws.Int64Value(deployment.DesiredCount)
+		progress.Running = aws.Int64Value(deployment.RunningCount)
+		progress.Pending = aws.Int64Value(deployment.PendingCount)
+		progress.Primary = aws.StringValue(deployment.Status) == "PRIMARY"
+		progress.RolloutState = aws.StringValue(deployment.RolloutState)
 	}
 
-	return false
+	return progress, nil
 }
 
+// IsTaskRunning waits until a task has stopped. A task can run for as long as it needs, so it
+// is polled until it stops without a limit on the number of attempts.
 func (u *UFO) IsTaskRunning(cluster *string, task *string) error {
-	err := u.ECS.WaitUntilTasksStoppedWithContext(aws.BackgroundContext(), &ecs.DescribeTasksInput{
+	return u.IsTaskRunningWithContext(aws.BackgroundContext(), cluster, task)
+}
+
+// IsTaskRunningWithContext is IsTaskRunning with a context to cancel its requests
+func (u *UFO) IsTaskRunningWithContext(ctx aws.Context, cluster *string, task *string) error {
+	err := u.ECS.WaitUntilTasksStoppedWithContext(ctx, &ecs.DescribeTasksInput{
 		Cluster: cluster,
 		Tasks:   []*string{task},
-	}, func(w *request.Waiter) {
+	}, request.WithWaiterMaxAttempts(0), func(w *request.Waiter) {
 		w.Delay = request.ConstantWaiterDelay(time.Second * 2)
 	})
 
 	return err
 }
 
-// ECRLogin uses an AWS region & profile to login to ECR
-func (u *UFO) ECRLogin() error {
-	input := &ecr.GetAuthorizationTokenInput{}
+// GetTaskExitCode returns the exit code of a container in a stopped task
+func (u *UFO) GetTaskExitCode(c *ecs.Cluster, task *string, container string) (int64, error) {
+	return u.GetTaskExitCodeWithContext(aws.BackgroundContext(), c, task, container)
+}
+
+// GetTaskExitCodeWithContext is GetTaskExitCode with a context to cancel its requests
+func (u *UFO) GetTaskExitCodeWithContext(ctx aws.Context, c *ecs.Cluster, task *string, container string) (int64, error) {
+	tasks, err := u.GetTasksWithContext(ctx, c, []*string{task})
 
-	resp, err := u.ECR.GetAuthorizationToken(input)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case ecr.ErrCodeServerException:
-				fmt.Println(ecr.ErrCodeServerException, aerr.Error())
-			case ecr.ErrCodeInvalidParameterException:
-				fmt.Println(ecr.ErrCodeInvalidParameterException, aerr.Error())
-			default:
-				fmt.Println(aerr.Error())
-			}
-		} else {
-			fmt.Println(aerr.Error())
+		return 0, err
+	}
+
+	if len(tasks) < 1 {
+		return 0, errors.New(errTaskNotFound)
+	}
+
+	for _, ctr := range tasks[0].Containers {
+		if aws.StringValue(ctr.Name) != container {
+			continue
+		}
+
+		if ctr.ExitCode == nil {
+			return 0, errors.Errorf("%s: %s", errTaskExitCodeUnknown, aws.StringValue(tasks[0].StoppedReason))
 		}
 
+		return *ctr.ExitCode, nil
 	}
 
-	auth := resp.AuthorizationData
-	decode, err := base64.StdEncoding.DecodeString(*auth[0].AuthorizationToken)
+	return 0, errors.Errorf("%s: %s", errContainerNotFound, container)
+}
+
+// ECRLogin uses an AWS region & profile to login to ECR
+func (u *UFO) ECRLogin() error {
+	return u.ECRLoginWithContext(aws.BackgroundContext())
+}
+
+// ECRLoginWithContext is ECRLogin with a context to cancel its requests
+func (u *UFO) ECRLoginWithContext(ctx aws.Context) error {
+	auth, err := u.ECRAuthWithContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	token := strings.SplitN(string(decode), ":", 2)
-	user := token[0]
-	password := token[1]
-	endpoint := *auth[0].ProxyEndpoint
-
-	cmd := fmt.Sprintf("docker login -u %s -p %s %s", user, password, endpoint)
+	cmd := fmt.Sprintf("docker login -u %s -p %s %s", auth.Username, auth.Password, auth.ServerAddress)
 	login := exec.Command("bash", "-c", cmd)
 	loginErr := login.Run()
 	if loginErr != nil {
-		return errors.Wrap(err, errECRLogin)
+		return errors.Wrap(loginErr, errECRLogin)
 	}
 
 	return nil
 }
 
+// ECRAuth returns the registry login of ECR for the Docker Engine API
+func (u *UFO) ECRAuth() (*docker.AuthConfig, error) {
+	return u.ECRAuthWithContext(aws.BackgroundContext())
+}
+
+// ECRAuthWithContext is ECRAuth with a context to cancel its requests
+func (u *UFO) ECRAuthWithContext(ctx aws.Context) (*docker.AuthConfig, error) {
+	input := &ecr.GetAuthorizationTokenInput{}
+
+	resp, err := u.ECR.GetAuthorizationTokenWithContext(ctx, input)
+	if err != nil {
+		return nil, errors.Wrap(err, errECRLogin)
+	}
+
+	if len(resp.AuthorizationData) == 0 {
+		return nil, errors.New(errECRLogin)
+	}
+
+	auth := resp.AuthorizationData
+	decode, err := base64.StdEncoding.DecodeString(*auth[0].AuthorizationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	token := strings.SplitN(string(decode), ":", 2)
+	if len(token) != 2 {
+		return nil, errors.New(errECRLogin)
+	}
+
+	return &docker.AuthConfig{
+		Username:      token[0],
+		Password:      token[1],
+		ServerAddress: *auth[0].ProxyEndpoint,
+	}, nil
+}
+
 type GetLogsInput struct {
 	Filter         string
 	LogGroupName   string
@@ -503,6 +940,11 @@ type LogLine struct {
 }
 
 func (u *UFO) GetLogs(i *GetLogsInput) ([]LogLine, error) {
+	return u.GetLogsWithContext(aws.BackgroundContext(), i)
+}
+
+// GetLogsWithContext is GetLogs with a context to cancel its requests
+func (u *UFO) GetLogsWithContext(ctx aws.Context, i *GetLogsInput) ([]LogLine, error) {
 	var logLines []LogLine
 
 	input := &cloudwatchlogs.FilterLogEventsInput{
@@ -526,7 +968,8 @@ func (u *UFO) GetLogs(i *GetLogsInput) ([]LogLine, error) {
 		input.SetLogStreamNames(aws.StringSlice(i.LogStreamNames))
 	}
 
-	err := u.CWL.FilterLogEventsPages(
+	err := u.CWL.FilterLogEventsPagesWithContext(
+		ctx,
 		input,
 		func(resp *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
 			for _, event := range resp.Events {
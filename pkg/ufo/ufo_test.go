@@ -1,9 +1,14 @@
 package ufo
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 
@@ -11,10 +16,13 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 
 	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/fuzz-productions/ufo/pkg/docker"
 )
 
 type mockedECRClient struct {
@@ -107,63 +115,280 @@ type mockedIsServiceRunning struct {
 	DescribeTasksError error
 }
 
-func (m mockedDescribeClusters) DescribeClusters(in *ecs.DescribeClustersInput) (*ecs.DescribeClustersOutput, error) {
+type mockedHistory struct {
+	ecsiface.ECSAPI
+	ListTaskDefsResp     *ecs.ListTaskDefinitionsOutput
+	DescribeTaskDefResps map[string]*ecs.DescribeTaskDefinitionOutput
+}
+
+func (m mockedHistory) ListTaskDefinitionsPagesWithContext(ctx aws.Context, in *ecs.ListTaskDefinitionsInput, fn func(*ecs.ListTaskDefinitionsOutput, bool) bool, opts ...request.Option) error {
+	fn(m.ListTaskDefsResp, true)
+	return nil
+}
+
+func (m mockedHistory) DescribeTaskDefinitionWithContext(ctx aws.Context, in *ecs.DescribeTaskDefinitionInput, opts ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return m.DescribeTaskDefResps[*in.TaskDefinition], nil
+}
+
+// mockedRollback describes the revisions of a task definition family and records the tags
+// and the task definition of a rollback
+type mockedRollback struct {
+	ecsiface.ECSAPI
+	tagged  string
+	tags    []*ecs.Tag
+	updated string
+	tagErr  error
+}
+
+func (m *mockedRollback) DescribeTaskDefinitionWithContext(ctx aws.Context, in *ecs.DescribeTaskDefinitionInput, opts ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return &ecs.DescribeTaskDefinitionOutput{
+		TaskDefinition: &ecs.TaskDefinition{
+			TaskDefinitionArn: aws.String("arn:aws:ecs:us-east-1:111222333444:task-definition/" + *in.TaskDefinition),
+		},
+	}, nil
+}
+
+func (m *mockedRollback) TagResourceWithContext(ctx aws.Context, in *ecs.TagResourceInput, opts ...request.Option) (*ecs.TagResourceOutput, error) {
+	if m.tagErr != nil {
+		return nil, m.tagErr
+	}
+
+	m.tagged, m.tags = *in.ResourceArn, in.Tags
+
+	return &ecs.TagResourceOutput{}, nil
+}
+
+func (m *mockedRollback) UpdateServiceWithContext(ctx aws.Context, in *ecs.UpdateServiceInput, opts ...request.Option) (*ecs.UpdateServiceOutput, error) {
+	m.updated = *in.TaskDefinition
+
+	return &ecs.UpdateServiceOutput{}, nil
+}
+
+type mockedReporter struct {
+	Events []*Event
+}
+
+func (m *mockedReporter) Report(e *Event) {
+	m.Events = append(m.Events, e)
+}
+
+// mockedLock stores the tags of a cluster. The Rival tags are written right after every
+// TagResource request, like a concurrent deploy that overwrites the lock.
+type mockedLock struct {
+	ecsiface.ECSAPI
+	Tags  map[string]string
+	Rival map[string]string
+}
+
+func (m mockedLock) ListTagsForResourceWithContext(ctx aws.Context, in *ecs.ListTagsForResourceInput, opts ...request.Option) (*ecs.ListTagsForResourceOutput, error) {
+	tags := []*ecs.Tag{}
+
+	for key, value := range m.Tags {
+		tags = append(tags, &ecs.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	return &ecs.ListTagsForResourceOutput{Tags: tags}, nil
+}
+
+func (m mockedLock) TagResourceWithContext(ctx aws.Context, in *ecs.TagResourceInput, opts ...request.Option) (*ecs.TagResourceOutput, error) {
+	for _, tag := range in.Tags {
+		m.Tags[*tag.Key] = *tag.Value
+	}
+
+	for key, value := range m.Rival {
+		m.Tags[key] = value
+	}
+
+	return &ecs.TagResourceOutput{}, nil
+}
+
+func (m mockedLock) UntagResourceWithContext(ctx aws.Context, in *ecs.UntagResourceInput, opts ...request.Option) (*ecs.UntagResourceOutput, error) {
+	for _, key := range in.TagKeys {
+		delete(m.Tags, *key)
+	}
+
+	return &ecs.UntagResourceOutput{}, nil
+}
+
+func (m mockedDescribeClusters) DescribeClustersWithContext(ctx aws.Context, in *ecs.DescribeClustersInput, opts ...request.Option) (*ecs.DescribeClustersOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedDescribeImages) DescribeImages(in *ecr.DescribeImagesInput) (*ecr.DescribeImagesOutput, error) {
+func (m mockedDescribeImages) DescribeImagesWithContext(ctx aws.Context, in *ecr.DescribeImagesInput, opts ...request.Option) (*ecr.DescribeImagesOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedDescribeServices) DescribeServices(in *ecs.DescribeServicesInput) (*ecs.DescribeServicesOutput, error) {
+// mockedTagImage stores the manifest of every tag of a repo
+type mockedTagImage struct {
+	ecriface.ECRAPI
+	manifests map[string]string
+}
+
+func (m *mockedTagImage) BatchGetImageWithContext(ctx aws.Context, in *ecr.BatchGetImageInput, opts ...request.Option) (*ecr.BatchGetImageOutput, error) {
+	manifest, ok := m.manifests[*in.ImageIds[0].ImageTag]
+	if !ok {
+		return &ecr.BatchGetImageOutput{}, nil
+	}
+
+	return &ecr.BatchGetImageOutput{
+		Images: []*ecr.Image{{ImageManifest: aws.String(manifest)}},
+	}, nil
+}
+
+func (m *mockedTagImage) PutImageWithContext(ctx aws.Context, in *ecr.PutImageInput, opts ...request.Option) (*ecr.PutImageOutput, error) {
+	if m.manifests[*in.ImageTag] == *in.ImageManifest {
+		return nil, awserr.New(ecr.ErrCodeImageAlreadyExistsException, "test-error", nil)
+	}
+
+	m.manifests[*in.ImageTag] = *in.ImageManifest
+
+	return &ecr.PutImageOutput{}, nil
+}
+
+// mockedBuiltImage is a repo that only has the images in its manifests
+type mockedBuiltImage struct {
+	*mockedTagImage
+}
+
+func (m mockedBuiltImage) DescribeImagesWithContext(ctx aws.Context, in *ecr.DescribeImagesInput, opts ...request.Option) (*ecr.DescribeImagesOutput, error) {
+	if _, ok := m.manifests[*in.ImageIds[0].ImageTag]; !ok {
+		return nil, awserr.New(ecr.ErrCodeImageNotFoundException, "test-error", nil)
+	}
+
+	return &ecr.DescribeImagesOutput{ImageDetails: []*ecr.ImageDetail{{}}}, nil
+}
+
+// mockedManifest returns the manifest of an image and the download URL of its config
+type mockedManifest struct {
+	ecriface.ECRAPI
+	manifest  string
+	configURL string
+}
+
+func (m mockedManifest) BatchGetImageWithContext(ctx aws.Context, in *ecr.BatchGetImageInput, opts ...request.Option) (*ecr.BatchGetImageOutput, error) {
+	return &ecr.BatchGetImageOutput{
+		Images: []*ecr.Image{{ImageManifest: aws.String(m.manifest)}},
+	}, nil
+}
+
+func (m mockedManifest) GetDownloadUrlForLayerWithContext(ctx aws.Context, in *ecr.GetDownloadUrlForLayerInput, opts ...request.Option) (*ecr.GetDownloadUrlForLayerOutput, error) {
+	return &ecr.GetDownloadUrlForLayerOutput{DownloadUrl: aws.String(m.configURL)}, nil
+}
+
+// mockedScan returns the response or error of DescribeImageScanFindings for every request,
+// one after another
+type mockedScan struct {
+	ecriface.ECRAPI
+	startError error
+	started    bool
+	responses  []*ecr.DescribeImageScanFindingsOutput
+	errors     []error
+}
+
+func (m *mockedScan) StartImageScanWithContext(ctx aws.Context, in *ecr.StartImageScanInput, opts ...request.Option) (*ecr.StartImageScanOutput, error) {
+	m.started = true
+
+	return &ecr.StartImageScanOutput{}, m.startError
+}
+
+func (m *mockedScan) DescribeImageScanFindingsWithContext(ctx aws.Context, in *ecr.DescribeImageScanFindingsInput, opts ...request.Option) (*ecr.DescribeImageScanFindingsOutput, error) {
+	resp, err := m.responses[0], m.errors[0]
+	m.responses, m.errors = m.responses[1:], m.errors[1:]
+
+	return resp, err
+}
+
+// mockedRunHook records the container a task ran its command in and stops the task with an
+// exit code for every container
+type mockedRunHook struct {
+	ecsiface.ECSAPI
+	container   string
+	exitCodes   map[string]int64
+	failures    []*ecs.Failure
+	maxAttempts int
+}
+
+func (m *mockedRunHook) RunTaskWithContext(ctx aws.Context, in *ecs.RunTaskInput, opts ...request.Option) (*ecs.RunTaskOutput, error) {
+	m.container = aws.StringValue(in.Overrides.ContainerOverrides[0].Name)
+
+	if len(m.failures) > 0 {
+		return &ecs.RunTaskOutput{Failures: m.failures}, nil
+	}
+
+	return &ecs.RunTaskOutput{Tasks: []*ecs.Task{{TaskArn: aws.String("taskarn")}}}, nil
+}
+
+func (m *mockedRunHook) WaitUntilTasksStoppedWithContext(ctx aws.Context, in *ecs.DescribeTasksInput, opts ...request.WaiterOption) error {
+	// The SDK default
+	w := &request.Waiter{MaxAttempts: 100}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	m.maxAttempts = w.MaxAttempts
+
+	return nil
+}
+
+func (m *mockedRunHook) DescribeTasksWithContext(ctx aws.Context, in *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error) {
+	task := &ecs.Task{TaskArn: aws.String("taskarn")}
+
+	for name, code := range m.exitCodes {
+		task.Containers = append(task.Containers, &ecs.Container{Name: aws.String(name), ExitCode: aws.Int64(code)})
+	}
+
+	return &ecs.DescribeTasksOutput{Tasks: []*ecs.Task{task}}, nil
+}
+
+func (m mockedDescribeServices) DescribeServicesWithContext(ctx aws.Context, in *ecs.DescribeServicesInput, opts ...request.Option) (*ecs.DescribeServicesOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedDescribeTaskDefinition) DescribeTaskDefinition(in *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
+func (m mockedDescribeTaskDefinition) DescribeTaskDefinitionWithContext(ctx aws.Context, in *ecs.DescribeTaskDefinitionInput, opts ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedDescribeTasks) DescribeTasks(in *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
+func (m mockedDescribeTasks) DescribeTasksWithContext(ctx aws.Context, in *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedListClusters) ListClusters(in *ecs.ListClustersInput) (*ecs.ListClustersOutput, error) {
+func (m mockedListClusters) ListClustersWithContext(ctx aws.Context, in *ecs.ListClustersInput, opts ...request.Option) (*ecs.ListClustersOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedListServices) ListServices(in *ecs.ListServicesInput) (*ecs.ListServicesOutput, error) {
+func (m mockedListServices) ListServicesWithContext(ctx aws.Context, in *ecs.ListServicesInput, opts ...request.Option) (*ecs.ListServicesOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedListTasks) ListTasks(in *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
+func (m mockedListTasks) ListTasksWithContext(ctx aws.Context, in *ecs.ListTasksInput, opts ...request.Option) (*ecs.ListTasksOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedRunTask) RunTask(in *ecs.RunTaskInput) (*ecs.RunTaskOutput, error) {
+func (m mockedRunTask) RunTaskWithContext(ctx aws.Context, in *ecs.RunTaskInput, opts ...request.Option) (*ecs.RunTaskOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedRegisterTaskDefinition) RegisterTaskDefinition(in *ecs.RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error) {
+func (m mockedRegisterTaskDefinition) RegisterTaskDefinitionWithContext(ctx aws.Context, in *ecs.RegisterTaskDefinitionInput, opts ...request.Option) (*ecs.RegisterTaskDefinitionOutput, error) {
 	return m.Resp, m.Error
 }
 
-func (m mockedDeploy) DescribeTaskDefinition(in *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
+func (m mockedDeploy) DescribeTaskDefinitionWithContext(ctx aws.Context, in *ecs.DescribeTaskDefinitionInput, opts ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
 	return m.DescribeTaskDefResp, m.DescribeTaskDefError
 }
 
-func (m mockedDeploy) RegisterTaskDefinition(in *ecs.RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error) {
+func (m mockedDeploy) RegisterTaskDefinitionWithContext(ctx aws.Context, in *ecs.RegisterTaskDefinitionInput, opts ...request.Option) (*ecs.RegisterTaskDefinitionOutput, error) {
 	return m.RegisterTaskDefResp, m.RegisterTaskDefError
 }
 
-func (m mockedDeploy) UpdateService(in *ecs.UpdateServiceInput) (*ecs.UpdateServiceOutput, error) {
+func (m mockedDeploy) UpdateServiceWithContext(ctx aws.Context, in *ecs.UpdateServiceInput, opts ...request.Option) (*ecs.UpdateServiceOutput, error) {
 	return m.UpdateServiceResp, m.UpdateServiceError
 }
 
-func (m mockedIsServiceRunning) ListTasks(in *ecs.ListTasksInput) (*ecs.ListTasksOutput, error) {
+func (m mockedIsServiceRunning) ListTasksWithContext(ctx aws.Context, in *ecs.ListTasksInput, opts ...request.Option) (*ecs.ListTasksOutput, error) {
 	return m.ListTasksResp, m.ListTasksError
 }
 
-func (m mockedIsServiceRunning) DescribeTasks(in *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error) {
+func (m mockedIsServiceRunning) DescribeTasksWithContext(ctx aws.Context, in *ecs.DescribeTasksInput, opts ...request.Option) (*ecs.DescribeTasksOutput, error) {
 	return m.DescribeTasksResp, m.DescribeTasksError
 }
 
@@ -826,307 +1051,2047 @@ func TestUFOGetImagesError(t *testing.T) {
 	}
 }
 
-func TestUFOGetLastDeployedCommit(t *testing.T) {
-	fam := "test-family"
-	subcommand := "echo"
-	command := []*string{&subcommand, &subcommand}
-	arn := "test-taskdefinitionarn"
-	image := "111222333444.dkr.ecr.us-west-1.amazonaws.com/image:ea13366"
+func TestUFOImageExists(t *testing.T) {
 	cases := []struct {
-		Resp     *ecs.DescribeTaskDefinitionOutput
-		Expected string
+		Resp     *ecr.DescribeImagesOutput
+		Error    error
+		Expected bool
 	}{
 		{
-			Resp: &ecs.DescribeTaskDefinitionOutput{
-				TaskDefinition: &ecs.TaskDefinition{
-					ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
-						Command: command,
-						Image:   &image,
-					}},
-					Family:            &fam,
-					TaskDefinitionArn: &arn,
-				},
+			Resp: &ecr.DescribeImagesOutput{
+				ImageDetails: []*ecr.ImageDetail{&ecr.ImageDetail{
+					ImageTags: aws.StringSlice([]string{"ea13366"}),
+				}},
 			},
-			Expected: "ea13366",
+			Expected: true,
+		},
+		{
+			Error:    awserr.New(ecr.ErrCodeImageNotFoundException, "test-error", nil),
+			Expected: false,
 		},
 	}
 
 	for i, c := range cases {
 		ufo := UFO{
-			ECS: &mockedDescribeTaskDefinition{Resp: c.Resp},
-			ECR: mockedECRClient{},
+			ECS: mockedECSClient{},
+			ECR: &mockedDescribeImages{Resp: c.Resp, Error: c.Error},
 		}
 
-		commit, err := ufo.GetLastDeployedCommit("111222333444.dkr.ecr.us-west-1.amazonaws.com/image:ea13366")
+		exists, err := ufo.ImageExists("111222333444.dkr.ecr.us-west-1.amazonaws.com/image", "ea13366")
 
 		if err != nil {
-			t.Fatalf("%d, unexpected error", err)
+			t.Fatalf("%d, unexpected error %v", i, err)
 		}
 
-		if a, e := commit, c.Expected; a != e {
-			t.Errorf("%d, expected %v commit, got %v", i, e, a)
+		if a, e := exists, c.Expected; a != e {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
 		}
 	}
 }
 
-func TestUFOGetLastDeployedCommitError(t *testing.T) {
+func TestUFOImageExistsError(t *testing.T) {
 	cases := []struct {
-		Resp     *ecs.DescribeTaskDefinitionOutput
+		Error    error
 		Expected error
 	}{
 		{
-			Resp: &ecs.DescribeTaskDefinitionOutput{
-				TaskDefinition: &ecs.TaskDefinition{
-					ContainerDefinitions: []*ecs.ContainerDefinition{},
-				}},
-			Expected: errors.Wrap(nil, errInvalidTaskDefinition),
+			Error:    errors.New("test-error"),
+			Expected: errors.Wrap(errors.New("test-error"), errCouldNotRetrieveImages),
 		},
 	}
 
 	for i, c := range cases {
 		ufo := UFO{
-			ECS: &mockedDescribeTaskDefinition{Resp: c.Resp},
-			ECR: mockedECRClient{},
+			ECS: mockedECSClient{},
+			ECR: &mockedDescribeImages{Resp: nil, Error: c.Error},
 		}
 
-		_, err := ufo.GetLastDeployedCommit("error-taskdef")
+		_, err := ufo.ImageExists("111222333444.dkr.ecr.us-west-1.amazonaws.com/image", "ea13366")
 
-		if a, e := err, c.Expected; a != e {
-			t.Errorf("%d, expected %v error, got %v", i, e, a)
+		if a, e := err, c.Expected; a.Error() != e.Error() {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
 		}
 	}
 }
 
-func TestUFOGetLastDeployedCommitError2(t *testing.T) {
+func TestUFOTagImage(t *testing.T) {
 	cases := []struct {
-		Error    error
-		Expected error
+		Manifests map[string]string
+		Tag       string
+		Tags      []string
+		Expected  map[string]string
+		Error     bool
 	}{
 		{
-			Error:    errors.New("test-error"),
-			Expected: errors.Wrap(errors.New("test-error"), errCouldNotRetrieveTaskDefinition),
+			Manifests: map[string]string{"ea13366": "new", "dev-latest": "old"},
+			Tag:       "ea13366",
+			Tags:      []string{"master", "dev-latest"},
+			Expected:  map[string]string{"ea13366": "new", "master": "new", "dev-latest": "new"},
+		},
+		{
+			Manifests: map[string]string{"ea13366": "new", "dev-latest": "new"},
+			Tag:       "ea13366",
+			Tags:      []string{"dev-latest"},
+			Expected:  map[string]string{"ea13366": "new", "dev-latest": "new"},
+		},
+		{
+			Manifests: map[string]string{},
+			Tag:       "ea13366",
+			Tags:      []string{"dev-latest"},
+			Expected:  map[string]string{},
+			Error:     true,
 		},
 	}
 
 	for i, c := range cases {
+		ecrClient := &mockedTagImage{manifests: c.Manifests}
 		ufo := UFO{
-			ECS: mockedDescribeTaskDefinition{Resp: nil, Error: c.Error},
-			ECR: mockedECRClient{},
+			ECS: mockedECSClient{},
+			ECR: ecrClient,
 		}
 
-		_, err := ufo.GetLastDeployedCommit("error")
+		err := ufo.TagImage("111222333444.dkr.ecr.us-west-1.amazonaws.com/image", c.Tag, c.Tags)
 
-		if a, e := err, c.Expected; a.Error() != e.Error() {
+		if a, e := err != nil, c.Error; a != e {
+			t.Fatalf("%d, expected error %v, got %v", i, e, err)
+		}
+
+		if a, e := ecrClient.manifests, c.Expected; !reflect.DeepEqual(a, e) {
 			t.Errorf("%d, expected %v, got %v", i, e, a)
 		}
 	}
 }
 
-func TestRegisterTaskDefinitionWithEnvVars(t *testing.T) {
+func TestUFOBuilder(t *testing.T) {
 	cases := []struct {
-		Resp     *ecs.RegisterTaskDefinitionOutput
-		Expected *ecs.TaskDefinition
-		Input    *ecs.ContainerDefinition
-		Error    error
+		Info     BuildDetail
+		Expected Builder
+		Error    string
+	}{
+		{Info: BuildDetail{}, Expected: &dockerBuilder{}},
+		{Info: BuildDetail{Builder: BuilderDocker}, Expected: &dockerBuilder{}},
+		{Info: BuildDetail{Builder: BuilderEngine}, Expected: &engineBuilder{}},
+		{Info: BuildDetail{Builder: BuilderBuildx}, Expected: &buildxBuilder{}},
+		{Info: BuildDetail{Builder: BuilderNone}, Expected: &noneBuilder{}},
+		{Info: BuildDetail{Builder: BuilderScript, BuildCommand: "./build.sh"}, Expected: &scriptBuilder{}},
+		{Info: BuildDetail{Builder: BuilderScript}, Error: errNoBuildCommand},
+		{Info: BuildDetail{Builder: "kaniko"}, Error: errUnknownBuilder},
+		{Info: BuildDetail{Builder: BuilderEngine, Platforms: []string{"linux/amd64", "linux/arm64"}}, Error: errMultiPlatformBuilder},
+		{Info: BuildDetail{Builder: BuilderEngine, Context: "app", Target: "release", Labels: []string{"team=api"}}, Expected: &engineBuilder{}},
+		{Info: BuildDetail{Builder: BuilderEngine, Secrets: []string{"id=npm,src=.npmrc"}}, Error: docker.ErrEngineBuildKit.Error()},
+		{Info: BuildDetail{Builder: BuilderEngine, SSH: []string{"default"}}, Error: docker.ErrEngineBuildKit.Error()},
+		{Info: BuildDetail{Builder: BuilderDocker, Secrets: []string{"id=npm,src=.npmrc"}, SSH: []string{"default"}}, Expected: &dockerBuilder{}},
+		{Info: BuildDetail{Builder: BuilderBuildx, Secrets: []string{"id=npm,src=.npmrc"}, SSH: []string{"default"}}, Expected: &buildxBuilder{}},
+	}
+
+	for i, c := range cases {
+		ufo := &UFO{}
+
+		builder, err := ufo.Builder(c.Info)
+
+		if c.Error == "" && err != nil {
+			t.Fatalf("%d, expected no error, got %v", i, err)
+		} else if c.Error != "" && (err == nil || !strings.HasPrefix(err.Error(), c.Error)) {
+			t.Fatalf("%d, expected error %s, got %v", i, c.Error, err)
+		}
+
+		if a, e := reflect.TypeOf(builder), reflect.TypeOf(c.Expected); c.Error == "" && a != e {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	deployment := &Deployment{}
+	deployment.SetRepo("repo")
+	deployment.SetCommitHash("a1b2c3d")
+	deployment.SetTags([]string{"main"})
+	deployment.SetDockerfile("app/Dockerfile")
+	deployment.SetContext("app")
+	deployment.SetTarget("release")
+	deployment.SetLabels([]string{"team=api"})
+	deployment.SetSecrets([]string{"id=npm,src=.npmrc"})
+	deployment.SetSSH([]string{"default"})
+
+	expected := &docker.BuildOptions{
+		Repo:       "repo",
+		Tag:        "a1b2c3d",
+		Tags:       []string{"main"},
+		Dockerfile: "app/Dockerfile",
+		Context:    "app",
+		Target:     "release",
+		Labels:     []string{"team=api"},
+		Secrets:    []string{"id=npm,src=.npmrc"},
+		SSH:        []string{"default"},
+	}
+
+	if a, e := buildOptions(deployment.BuildDetail), expected; !reflect.DeepEqual(a, e) {
+		t.Errorf("expected %+v, got %+v", e, a)
+	}
+}
+
+func TestUFONoneBuilder(t *testing.T) {
+	cases := []struct {
+		Resp  *ecr.DescribeImagesOutput
+		Error error
+		Fails bool
 	}{
 		{
-			Resp: &ecs.RegisterTaskDefinitionOutput{
-				TaskDefinition: &ecs.TaskDefinition{
-					ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
-						Environment: []*ecs.KeyValuePair{&ecs.KeyValuePair{
-							Name:  aws.String("KEY1"),
-							Value: aws.String("VALUE1"),
-						}},
-					}},
-				},
-			},
-			Input: &ecs.ContainerDefinition{},
-			Error: nil,
-			Expected: &ecs.TaskDefinition{
-				ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
-					Environment: []*ecs.KeyValuePair{&ecs.KeyValuePair{
-						Name:  aws.String("KEY1"),
-						Value: aws.String("VALUE1"),
-					}},
-				}},
+			Resp: &ecr.DescribeImagesOutput{
+				ImageDetails: []*ecr.ImageDetail{{ImageTags: aws.StringSlice([]string{"ea13366"})}},
 			},
 		},
+		{
+			Error: awserr.New(ecr.ErrCodeImageNotFoundException, "test-error", nil),
+			Fails: true,
+		},
 	}
 
 	for i, c := range cases {
+		reporter := &mockedReporter{}
 		ufo := UFO{
-			ECS: mockedRegisterTaskDefinition{Resp: c.Resp, Error: c.Error},
-			ECR: mockedECRClient{},
+			ECS:      mockedECSClient{},
+			ECR:      &mockedDescribeImages{Resp: c.Resp, Error: c.Error},
+			Reporter: reporter,
 		}
 
-		def, err := ufo.RegisterTaskDefinitionWithEnvVars(&ecs.TaskDefinition{
-			Cpu:                     aws.String("256"),
-			Family:                  aws.String("Family"),
-			Memory:                  aws.String("512"),
-			Volumes:                 []*ecs.Volume{},
-			NetworkMode:             aws.String("Bridge"),
-			ExecutionRoleArn:        aws.String("Role"),
-			TaskRoleArn:             aws.String("Role"),
-			ContainerDefinitions:    []*ecs.ContainerDefinition{c.Input},
-			RequiresCompatibilities: aws.StringSlice([]string{}),
+		err := ufo.LoginBuildPushImage(BuildDetail{
+			Repo:       "111222333444.dkr.ecr.us-west-1.amazonaws.com/image",
+			CommitHash: "ea13366",
+			Builder:    BuilderNone,
 		})
 
-		if err != nil {
-			t.Fatalf("%d, unexpected error", err)
+		if a, e := err != nil, c.Fails; a != e {
+			t.Fatalf("%d, expected error %v, got %v", i, e, err)
 		}
 
-		a := *def.ContainerDefinitions[0].Environment[0].Value
-		e := *c.Expected.ContainerDefinitions[0].Environment[0].Value
-
-		if a != e {
-			t.Errorf("%d, expected %v value, got %v", i, e, a)
+		if c.Fails && (len(reporter.Events) != 1 || reporter.Events[0].Type != EventFailed) {
+			t.Errorf("%d, expected a failed event, got %v", i, reporter.Events)
 		}
 	}
 }
 
-func TestRegisterTaskDefinitionWithEnvVarsError(t *testing.T) {
+func TestUFOScriptBuilder(t *testing.T) {
+	repo := "111222333444.dkr.ecr.us-west-1.amazonaws.com/image"
+
 	cases := []struct {
-		Resp     *ecs.RegisterTaskDefinitionOutput
-		Expected error
-		Input    *ecs.ContainerDefinition
-		Error    error
+		Command        string
+		Manifests      map[string]string
+		Fails          bool
+		ExpectedImages []string
+		ExpectedDigest string
 	}{
 		{
-			Resp:     &ecs.RegisterTaskDefinitionOutput{},
-			Input:    &ecs.ContainerDefinition{},
-			Error:    errors.New("test-error"),
-			Expected: errors.Wrap(errors.New("test-error"), errCouldNotRegisterTaskDefinition),
+			Command:        "echo building; echo $UFO_IMAGE",
+			Manifests:      map[string]string{"ea13366": "manifest"},
+			ExpectedImages: []string{repo + ":ea13366", repo + ":latest", repo + ":main"},
+		},
+		{
+			Command:        "echo $UFO_IMAGE@sha256:abc",
+			Manifests:      map[string]string{"ea13366": "manifest"},
+			ExpectedImages: []string{repo + ":ea13366", repo + ":latest", repo + ":main"},
+			ExpectedDigest: "sha256:abc",
+		},
+		{
+			Command:   "echo $UFO_REPO:other",
+			Manifests: map[string]string{"ea13366": "manifest"},
+			Fails:     true,
+		},
+		{
+			Command:   "echo $UFO_IMAGE",
+			Manifests: map[string]string{},
+			Fails:     true,
+		},
+		{
+			Command:   "echo $UFO_IMAGE; exit 1",
+			Manifests: map[string]string{"ea13366": "manifest"},
+			Fails:     true,
 		},
 	}
 
 	for i, c := range cases {
+		reporter := &mockedReporter{}
+		ecrClient := mockedBuiltImage{&mockedTagImage{manifests: c.Manifests}}
 		ufo := UFO{
-			ECS: mockedRegisterTaskDefinition{Resp: c.Resp, Error: c.Error},
-			ECR: mockedECRClient{},
+			ECS:      mockedECSClient{},
+			ECR:      ecrClient,
+			Reporter: reporter,
 		}
 
-		_, err := ufo.RegisterTaskDefinitionWithEnvVars(&ecs.TaskDefinition{})
+		err := ufo.LoginBuildPushImage(BuildDetail{
+			Repo:         repo,
+			CommitHash:   "ea13366",
+			Tags:         []string{"latest", "main"},
+			Builder:      BuilderScript,
+			BuildCommand: c.Command,
+		})
 
-		if a, e := err, c.Expected; a.Error() != e.Error() {
-			t.Errorf("%d, expected %v, got %v", i, e, a)
+		if a, e := err != nil, c.Fails; a != e {
+			t.Fatalf("%d, expected error %v, got %v", i, e, err)
 		}
-	}
-}
 
-func TestUFORunTask(t *testing.T) {
-	cases := []struct {
-		Resp     *ecs.RunTaskOutput
-		Expected *ecs.RunTaskOutput
-	}{
+		if c.Fails {
+			if last := reporter.Events[len(reporter.Events)-1]; last.Type != EventFailed {
+				t.Errorf("%d, expected a failed event, got %v", i, last)
+			}
+
+			continue
+		}
+
+		images := []string{}
+		for _, e := range reporter.Events {
+			if e.Type != EventImagePushed {
+				continue
+			}
+
+			images = append(images, e.Image)
+
+			if a, e := e.Digest, c.ExpectedDigest; a != e {
+				t.Errorf("%d, expected digest %q, got %q", i, e, a)
+			}
+		}
+
+		if a, e := images, c.ExpectedImages; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected pushed images %v, got %v", i, e, a)
+		}
+
+		for _, tag := range []string{"latest", "main"} {
+			if a, e := ecrClient.manifests[tag], "manifest"; a != e {
+				t.Errorf("%d, expected tag %s to point to %s, got %q", i, tag, e, a)
+			}
+		}
+	}
+}
+
+func TestUFOImagePlatformCheck(t *testing.T) {
+	config := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"architecture":"amd64","os":"linux"}`)
+	}))
+	defer config.Close()
+
+	list := `{"manifests":[
+		{"platform":{"architecture":"amd64","os":"linux"}},
+		{"platform":{"architecture":"arm64","os":"linux"}},
+		{"platform":{"architecture":"unknown","os":"unknown"}}
+	]}`
+	single := `{"config":{"digest":"sha256:abc"}}`
+
+	taskDef := func(arch string) *ecs.TaskDefinition {
+		t := &ecs.TaskDefinition{}
+		if arch != "" {
+			t.RuntimePlatform = &ecs.RuntimePlatform{CpuArchitecture: aws.String(arch)}
+		}
+		return t
+	}
+
+	cases := []struct {
+		Manifest       string
+		TaskDefinition *ecs.TaskDefinition
+		Error          bool
+	}{
+		{Manifest: list, TaskDefinition: taskDef(ecs.CPUArchitectureArm64)},
+		{Manifest: list, TaskDefinition: taskDef(ecs.CPUArchitectureX8664)},
+		{Manifest: single, TaskDefinition: taskDef(ecs.CPUArchitectureX8664)},
+		{Manifest: single, TaskDefinition: taskDef(ecs.CPUArchitectureArm64), Error: true},
+		{Manifest: "not read", TaskDefinition: taskDef("")},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedECSClient{},
+			ECR: mockedManifest{manifest: c.Manifest, configURL: config.URL},
+		}
+
+		check := ufo.platformCheck(aws.BackgroundContext(), BuildDetail{
+			Repo:       "111222333444.dkr.ecr.us-west-1.amazonaws.com/image",
+			CommitHash: "ea13366",
+		})
+
+		err := check(c.TaskDefinition)
+
+		if a, e := err != nil, c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, err)
+		}
+	}
+}
+
+func TestUFOScanImage(t *testing.T) {
+	scanWaitTime = 0
+
+	scanOutput := func(status string, next string, findings ...*ecr.ImageScanFinding) *ecr.DescribeImageScanFindingsOutput {
+		out := &ecr.DescribeImageScanFindingsOutput{
+			ImageScanStatus: &ecr.ImageScanStatus{Status: aws.String(status)},
+		}
+
+		if status == ecr.ScanStatusComplete {
+			out.ImageScanFindings = &ecr.ImageScanFindings{
+				Findings:              findings,
+				FindingSeverityCounts: map[string]*int64{ecr.FindingSeverityCritical: aws.Int64(1), ecr.FindingSeverityLow: aws.Int64(1)},
+			}
+		}
+
+		if next != "" {
+			out.NextToken = aws.String(next)
+		}
+
+		return out
+	}
+
+	critical := &ecr.ImageScanFinding{
+		Name:       aws.String("CVE-2021-3711"),
+		Severity:   aws.String(ecr.FindingSeverityCritical),
+		Attributes: []*ecr.Attribute{{Key: aws.String("package_name"), Value: aws.String("openssl")}},
+	}
+	low := &ecr.ImageScanFinding{
+		Name:     aws.String("CVE-2020-1752"),
+		Severity: aws.String(ecr.FindingSeverityLow),
+	}
+	notFound := awserr.New(ecr.ErrCodeScanNotFoundException, "test-error", nil)
+
+	cases := []struct {
+		Start      bool
+		StartError error
+		Responses  []*ecr.DescribeImageScanFindingsOutput
+		Errors     []error
+		Expected   []*ScanFinding
+		Error      bool
+	}{
+		{
+			Start:     true,
+			Responses: []*ecr.DescribeImageScanFindingsOutput{scanOutput(ecr.ScanStatusInProgress, ""), scanOutput(ecr.ScanStatusComplete, "", critical, low)},
+			Errors:    []error{nil, nil},
+			Expected: []*ScanFinding{
+				{Name: "CVE-2021-3711", Severity: ecr.FindingSeverityCritical, Package: "openssl"},
+				{Name: "CVE-2020-1752", Severity: ecr.FindingSeverityLow},
+			},
+		},
+		{
+			Start:      true,
+			StartError: awserr.New(ecr.ErrCodeLimitExceededException, "test-error", nil),
+			Responses:  []*ecr.DescribeImageScanFindingsOutput{scanOutput(ecr.ScanStatusComplete, "page-2", critical), scanOutput(ecr.ScanStatusComplete, "", low)},
+			Errors:     []error{nil, nil},
+			Expected: []*ScanFinding{
+				{Name: "CVE-2021-3711", Severity: ecr.FindingSeverityCritical, Package: "openssl"},
+				{Name: "CVE-2020-1752", Severity: ecr.FindingSeverityLow},
+			},
+		},
+		{
+			Responses: []*ecr.DescribeImageScanFindingsOutput{nil, scanOutput(ecr.ScanStatusComplete, "")},
+			Errors:    []error{notFound, nil},
+			Expected:  []*ScanFinding{},
+		},
+		{
+			Start:      true,
+			StartError: awserr.New(ecr.ErrCodeRepositoryNotFoundException, "test-error", nil),
+			Error:      true,
+		},
+		{
+			Responses: []*ecr.DescribeImageScanFindingsOutput{nil, nil, nil, nil},
+			Errors:    []error{notFound, notFound, notFound, notFound},
+			Error:     true,
+		},
+		{
+			Responses: []*ecr.DescribeImageScanFindingsOutput{scanOutput(ecr.ScanStatusUnsupportedImage, "")},
+			Errors:    []error{nil},
+			Error:     true,
+		},
+	}
+
+	for i, c := range cases {
+		ecrClient := &mockedScan{startError: c.StartError, responses: c.Responses, errors: c.Errors}
+		ufo := UFO{
+			ECS: mockedECSClient{},
+			ECR: ecrClient,
+		}
+
+		result, err := ufo.ScanImage("111222333444.dkr.ecr.us-west-1.amazonaws.com/image", "ea13366", c.Start)
+
+		if a, e := err != nil, c.Error; a != e {
+			t.Fatalf("%d, expected error %v, got %v", i, e, err)
+		}
+
+		if a, e := ecrClient.started, c.Start; a != e {
+			t.Errorf("%d, expected started %v, got %v", i, e, a)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if a, e := result.Findings, c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestScanResultBlocking(t *testing.T) {
+	result := &ScanResult{
+		Findings: []*ScanFinding{
+			{Name: "CVE-2021-3711", Severity: ecr.FindingSeverityCritical},
+			{Name: "CVE-2021-23840", Severity: ecr.FindingSeverityHigh},
+			{Name: "CVE-2020-1752", Severity: ecr.FindingSeverityLow},
+		},
+	}
+
+	cases := []struct {
+		Threshold string
+		Allow     []string
+		Expected  []string
+		Error     bool
+	}{
+		{Threshold: ecr.FindingSeverityCritical, Expected: []string{"CVE-2021-3711"}},
+		{Threshold: ecr.FindingSeverityHigh, Expected: []string{"CVE-2021-3711", "CVE-2021-23840"}},
+		{Threshold: ecr.FindingSeverityHigh, Allow: []string{"CVE-2021-3711"}, Expected: []string{"CVE-2021-23840"}},
+		{Threshold: ecr.FindingSeverityInformational, Allow: []string{"CVE-2020-1752"}, Expected: []string{"CVE-2021-3711", "CVE-2021-23840"}},
+		{Threshold: "SEVERE", Error: true},
+	}
+
+	for i, c := range cases {
+		blocking, err := result.Blocking(c.Threshold, c.Allow)
+
+		if a, e := err != nil, c.Error; a != e {
+			t.Fatalf("%d, expected error %v, got %v", i, e, err)
+		}
+
+		names := []string{}
+		for _, finding := range blocking {
+			names = append(names, finding.Name)
+		}
+
+		if c.Error {
+			continue
+		}
+
+		if a, e := names, c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestDeploymentDeployedImages(t *testing.T) {
+	repo := "111222333444.dkr.ecr.us-west-1.amazonaws.com/image"
+	taskDef := func(images ...string) *ecs.TaskDefinition {
+		t := &ecs.TaskDefinition{}
+		for _, image := range images {
+			t.ContainerDefinitions = append(t.ContainerDefinitions, &ecs.ContainerDefinition{Image: aws.String(image)})
+		}
+		return t
+	}
+
+	cases := []struct {
+		Details  []*DeployDetail
+		Expected []string
+	}{
+		{
+			Details: []*DeployDetail{
+				{TaskDefinition: taskDef(repo+":ea13366", "nginx:1.19")},
+				{TaskDefinition: taskDef(repo + ":ea13366")},
+				{TaskDefinition: taskDef(repo + ":b4c7e21")},
+			},
+			Expected: []string{repo + ":ea13366", repo + ":b4c7e21"},
+		},
+		{
+			Details: []*DeployDetail{
+				{TaskDefinition: taskDef(repo+"-worker:ea13366", "nginx:1.19")},
+				{},
+			},
+			Expected: []string{},
+		},
+	}
+
+	for i, c := range cases {
+		deployment := &Deployment{DeployDetails: c.Details}
+		deployment.SetRepo(repo)
+
+		if a, e := deployment.DeployedImages(), c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestDeploymentRepos(t *testing.T) {
+	repo := "111222333444.dkr.ecr.us-west-1.amazonaws.com/image"
+	taskDef := &ecs.TaskDefinition{
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("app"), Image: aws.String(repo + ":ea13366")},
+			{Name: aws.String("worker"), Image: aws.String(repo + "-worker:ea13366")},
+			{Name: aws.String("nginx"), Image: aws.String("nginx:1.19")},
+		},
+	}
+
+	cases := []struct {
+		Details  []*DeployDetail
+		Repos    map[string]string
+		Expected []string
+	}{
+		{
+			Details:  []*DeployDetail{{TaskDefinition: taskDef}, {TaskDefinition: taskDef}},
+			Expected: []string{repo},
+		},
+		{
+			Details:  []*DeployDetail{{TaskDefinition: taskDef}},
+			Repos:    map[string]string{"app": repo, "worker": "", "sidecar": "111222333444.dkr.ecr.us-west-1.amazonaws.com/sidecar"},
+			Expected: []string{repo, "111222333444.dkr.ecr.us-west-1.amazonaws.com/image-worker", "111222333444.dkr.ecr.us-west-1.amazonaws.com/sidecar"},
+		},
+		{
+			Details:  []*DeployDetail{{}},
+			Expected: []string{},
+		},
+	}
+
+	for i, c := range cases {
+		deployment := &Deployment{DeployDetails: c.Details}
+		deployment.SetContainerRepos(c.Repos)
+
+		if a, e := deployment.Repos(), c.Expected; !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOGetLastDeployedCommit(t *testing.T) {
+	fam := "test-family"
+	subcommand := "echo"
+	command := []*string{&subcommand, &subcommand}
+	arn := "test-taskdefinitionarn"
+	image := "111222333444.dkr.ecr.us-west-1.amazonaws.com/image:ea13366"
+	cases := []struct {
+		Resp     *ecs.DescribeTaskDefinitionOutput
+		Expected string
+	}{
+		{
+			Resp: &ecs.DescribeTaskDefinitionOutput{
+				TaskDefinition: &ecs.TaskDefinition{
+					ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+						Command: command,
+						Image:   &image,
+					}},
+					Family:            &fam,
+					TaskDefinitionArn: &arn,
+				},
+			},
+			Expected: "ea13366",
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: &mockedDescribeTaskDefinition{Resp: c.Resp},
+			ECR: mockedECRClient{},
+		}
+
+		commit, err := ufo.GetLastDeployedCommit("111222333444.dkr.ecr.us-west-1.amazonaws.com/image:ea13366")
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error", err)
+		}
+
+		if a, e := commit, c.Expected; a != e {
+			t.Errorf("%d, expected %v commit, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOGetLastDeployedCommitError(t *testing.T) {
+	cases := []struct {
+		Resp     *ecs.DescribeTaskDefinitionOutput
+		Expected error
+	}{
+		{
+			Resp: &ecs.DescribeTaskDefinitionOutput{
+				TaskDefinition: &ecs.TaskDefinition{
+					ContainerDefinitions: []*ecs.ContainerDefinition{},
+				}},
+			Expected: errors.New(errInvalidTaskDefinition),
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: &mockedDescribeTaskDefinition{Resp: c.Resp},
+			ECR: mockedECRClient{},
+		}
+
+		_, err := ufo.GetLastDeployedCommit("error-taskdef")
+
+		if a, e := err, c.Expected; a == nil || a.Error() != e.Error() {
+			t.Errorf("%d, expected %v error, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOGetLastDeployedCommitError2(t *testing.T) {
+	cases := []struct {
+		Error    error
+		Expected error
+	}{
+		{
+			Error:    errors.New("test-error"),
+			Expected: errors.Wrap(errors.New("test-error"), errCouldNotRetrieveTaskDefinition),
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedDescribeTaskDefinition{Resp: nil, Error: c.Error},
+			ECR: mockedECRClient{},
+		}
+
+		_, err := ufo.GetLastDeployedCommit("error")
+
+		if a, e := err, c.Expected; a.Error() != e.Error() {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestRegisterTaskDefinitionWithEnvVars(t *testing.T) {
+	cases := []struct {
+		Resp     *ecs.RegisterTaskDefinitionOutput
+		Expected *ecs.TaskDefinition
+		Input    *ecs.ContainerDefinition
+		Error    error
+	}{
+		{
+			Resp: &ecs.RegisterTaskDefinitionOutput{
+				TaskDefinition: &ecs.TaskDefinition{
+					ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+						Environment: []*ecs.KeyValuePair{&ecs.KeyValuePair{
+							Name:  aws.String("KEY1"),
+							Value: aws.String("VALUE1"),
+						}},
+					}},
+				},
+			},
+			Input: &ecs.ContainerDefinition{},
+			Error: nil,
+			Expected: &ecs.TaskDefinition{
+				ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+					Environment: []*ecs.KeyValuePair{&ecs.KeyValuePair{
+						Name:  aws.String("KEY1"),
+						Value: aws.String("VALUE1"),
+					}},
+				}},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedRegisterTaskDefinition{Resp: c.Resp, Error: c.Error},
+			ECR: mockedECRClient{},
+		}
+
+		def, err := ufo.RegisterTaskDefinitionWithEnvVars(&ecs.TaskDefinition{
+			Cpu:                     aws.String("256"),
+			Family:                  aws.String("Family"),
+			Memory:                  aws.String("512"),
+			Volumes:                 []*ecs.Volume{},
+			NetworkMode:             aws.String("Bridge"),
+			ExecutionRoleArn:        aws.String("Role"),
+			TaskRoleArn:             aws.String("Role"),
+			ContainerDefinitions:    []*ecs.ContainerDefinition{c.Input},
+			RequiresCompatibilities: aws.StringSlice([]string{}),
+		}, nil)
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error", err)
+		}
+
+		a := *def.ContainerDefinitions[0].Environment[0].Value
+		e := *c.Expected.ContainerDefinitions[0].Environment[0].Value
+
+		if a != e {
+			t.Errorf("%d, expected %v value, got %v", i, e, a)
+		}
+	}
+}
+
+func TestRegisterTaskDefinitionWithEnvVarsError(t *testing.T) {
+	cases := []struct {
+		Resp     *ecs.RegisterTaskDefinitionOutput
+		Expected error
+		Input    *ecs.ContainerDefinition
+		Error    error
+	}{
+		{
+			Resp:     &ecs.RegisterTaskDefinitionOutput{},
+			Input:    &ecs.ContainerDefinition{},
+			Error:    errors.New("test-error"),
+			Expected: errors.Wrap(errors.New("test-error"), errCouldNotRegisterTaskDefinition),
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedRegisterTaskDefinition{Resp: c.Resp, Error: c.Error},
+			ECR: mockedECRClient{},
+		}
+
+		_, err := ufo.RegisterTaskDefinitionWithEnvVars(&ecs.TaskDefinition{}, nil)
+
+		if a, e := err, c.Expected; a.Error() != e.Error() {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFORunTask(t *testing.T) {
+	cases := []struct {
+		Resp     *ecs.RunTaskOutput
+		Expected *ecs.RunTaskOutput
+	}{
+		{
+			Resp: &ecs.RunTaskOutput{
+				Tasks: []*ecs.Task{&ecs.Task{
+					ClusterArn:        aws.String("clusterarn"),
+					TaskDefinitionArn: aws.String("taskdefarn"),
+					Overrides: &ecs.TaskOverride{
+						ContainerOverrides: []*ecs.ContainerOverride{
+							&ecs.ContainerOverride{
+								Command: aws.StringSlice([]string{"echo", "this"}),
+								Name:    aws.String("task"),
+							},
+						},
+					},
+				}},
+			},
+			Expected: &ecs.RunTaskOutput{
+				Tasks: []*ecs.Task{&ecs.Task{
+					ClusterArn:        aws.String("clusterarn"),
+					TaskDefinitionArn: aws.String("taskdefarn"),
+					Overrides: &ecs.TaskOverride{
+						ContainerOverrides: []*ecs.ContainerOverride{
+							&ecs.ContainerOverride{
+								Command: aws.StringSlice([]string{"echo", "this"}),
+								Name:    aws.String("task"),
+							},
+						},
+					},
+				}},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedRunTask{Resp: c.Resp},
+			ECR: mockedECRClient{},
+		}
+
+		ranTasks, err := ufo.RunTask(
+			&ecs.Cluster{ClusterName: aws.String("test-cluster")},
+			&ecs.TaskDefinition{
+				TaskDefinitionArn: aws.String("taskdefarn"),
+				ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+					Name: aws.String("test-container"),
+				}},
+			},
+			"echo this",
+		)
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error", err)
+		}
+
+		for j, task := range ranTasks.Tasks {
+			if a, e := *task.ClusterArn, *c.Expected.Tasks[j].ClusterArn; a != e {
+				t.Errorf("%d, expected %v cluster arn, got %v", i, e, a)
+			}
+
+			if a, e := *task.TaskDefinitionArn, *c.Expected.Tasks[j].TaskDefinitionArn; a != e {
+				t.Errorf("%d, expected %v task definition arn, got %v", i, e, a)
+			}
+
+			actualOverride := task.Overrides.ContainerOverrides[0]
+			expectedOverride := c.Expected.Tasks[j].Overrides.ContainerOverrides[0]
+
+			if a, e := *actualOverride.Name, *expectedOverride.Name; a != e {
+				t.Errorf("%d, expected %v name, got %v", i, e, a)
+			}
+
+			actualOverrideCommand := strings.Join(aws.StringValueSlice(actualOverride.Command), " ")
+			expectedOverrideCommand := strings.Join(aws.StringValueSlice(expectedOverride.Command), " ")
+
+			if a, e := actualOverrideCommand, expectedOverrideCommand; a != e {
+				t.Errorf("%d, expected %v command override, got %v", i, e, a)
+			}
+		}
+	}
+}
+
+func TestUFORunTaskError(t *testing.T) {
+	cases := []struct {
+		Error    error
+		Expected error
+	}{
+		{
+			Error:    errors.New("test-error"),
+			Expected: errors.Wrap(errors.New("test-error"), errCouldNotRunTask),
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedRunTask{Resp: nil, Error: c.Error},
+			ECR: mockedECRClient{},
+		}
+
+		_, err := ufo.RunTask(
+			&ecs.Cluster{ClusterName: aws.String("test-cluster")},
+			&ecs.TaskDefinition{
+				TaskDefinitionArn: aws.String("taskdefarn"),
+				ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+					Name: aws.String("test-container"),
+				}},
+			},
+			"error",
+		)
+
+		if a, e := err, c.Expected; a.Error() != e.Error() {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFORunHook(t *testing.T) {
+	taskDefinition := &ecs.TaskDefinition{
+		TaskDefinitionArn: aws.String("taskdefarn"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{
+			{Name: aws.String("log-router")},
+			{Name: aws.String("app")},
+		},
+	}
+
+	cases := []struct {
+		Container string
+		Failures  []*ecs.Failure
+		Expected  string
+		Error     string
+	}{
+		{Container: "app", Expected: "app", Error: errHookFailed},
+		{Container: "", Expected: "log-router"},
+		{Container: "worker", Error: errContainerNotFound},
+		{
+			Container: "app",
+			Failures:  []*ecs.Failure{{Arn: aws.String("instancearn"), Reason: aws.String("RESOURCE:MEMORY"), Detail: aws.String("no capacity")}},
+			Expected:  "app",
+			Error:     errTaskNotStarted + ": RESOURCE:MEMORY (no capacity)",
+		},
+	}
+
+	for i, c := range cases {
+		ecsClient := &mockedRunHook{exitCodes: map[string]int64{"log-router": 0, "app": 1}, failures: c.Failures}
+		ufo := UFO{
+			ECS: ecsClient,
+			ECR: mockedECRClient{},
+		}
+
+		detail := &DeployDetail{
+			Cluster:        &ecs.Cluster{ClusterName: aws.String("test-cluster"), ClusterArn: aws.String("clusterarn")},
+			TaskDefinition: taskDefinition,
+		}
+
+		err := ufo.RunHook(detail, c.Container, "migrate")
+
+		if c.Error == "" && err != nil {
+			t.Errorf("%d, expected no error, got %s", i, err)
+		} else if c.Error != "" && (err == nil || !strings.HasPrefix(err.Error(), c.Error)) {
+			t.Errorf("%d, expected error %s, got %v", i, c.Error, err)
+		}
+
+		if a, e := ecsClient.container, c.Expected; a != e {
+			t.Errorf("%d, expected the command to run in %q, got %q", i, e, a)
+		}
+
+		// A hook is waited for however long it runs
+		if a := ecsClient.maxAttempts; err == nil && a != 0 {
+			t.Errorf("%d, expected the task to be polled without an attempt limit, got %d attempts", i, a)
+		}
+	}
+}
+
+func TestUFOUpdateTaskDefinitionImage(t *testing.T) {
+	cases := []struct {
+		Repos    map[string]string
+		Expected map[string]string
+	}{
+		{
+			Repos: map[string]string{},
+			Expected: map[string]string{
+				"app":   "111222333444.dkr.ecr.us-west-1.amazonaws.com/app:8c018c8",
+				"nginx": "111222333444.dkr.ecr.us-west-1.amazonaws.com/nginx:cbd0d9c",
+				"log":   "amazon/aws-for-fluent-bit:latest",
+			},
+		},
+		{
+			Repos: map[string]string{
+				"app":   "",
+				"nginx": "111222333444.dkr.ecr.us-west-1.amazonaws.com/proxy",
+			},
+			Expected: map[string]string{
+				"app":   "111222333444.dkr.ecr.us-west-1.amazonaws.com/app:8c018c8",
+				"nginx": "111222333444.dkr.ecr.us-west-1.amazonaws.com/proxy:8c018c8",
+				"log":   "amazon/aws-for-fluent-bit:latest",
+			},
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedECSClient{},
+			ECR: mockedECRClient{},
+		}
+
+		taskDef, err := ufo.UpdateTaskDefinitionImage(ecs.TaskDefinition{
+			ContainerDefinitions: []*ecs.ContainerDefinition{
+				&ecs.ContainerDefinition{
+					Name:  aws.String("app"),
+					Image: aws.String("111222333444.dkr.ecr.us-west-1.amazonaws.com/app:cbd0d9c"),
+				},
+				&ecs.ContainerDefinition{
+					Name:  aws.String("nginx"),
+					Image: aws.String("111222333444.dkr.ecr.us-west-1.amazonaws.com/nginx:cbd0d9c"),
+				},
+				&ecs.ContainerDefinition{
+					Name:  aws.String("log"),
+					Image: aws.String("amazon/aws-for-fluent-bit:latest"),
+				},
+			},
+		}, "8c018c8", c.Repos)
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error %v", i, err)
+		}
+
+		for _, container := range taskDef.ContainerDefinitions {
+			if a, e := *container.Image, c.Expected[*container.Name]; a != e {
+				t.Errorf("%d, expected %v image for %s, got %v", i, e, *container.Name, a)
+			}
+		}
+	}
+}
+
+func TestUFOUpdateTaskDefinitionImageError(t *testing.T) {
+	cases := []struct {
+		Repos    map[string]string
+		Expected error
+	}{
+		{
+			Repos:    map[string]string{"worker": ""},
+			Expected: errors.Errorf("%s: %s", errContainerNotFound, "worker"),
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedECSClient{},
+			ECR: mockedECRClient{},
+		}
+
+		_, err := ufo.UpdateTaskDefinitionImage(ecs.TaskDefinition{
+			ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+				Name:  aws.String("app"),
+				Image: aws.String("111222333444.dkr.ecr.us-west-1.amazonaws.com/app:cbd0d9c"),
+			}},
+		}, "8c018c8", c.Repos)
+
+		if a, e := err, c.Expected; a == nil || a.Error() != e.Error() {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOGetLastDeployedCommitForContainer(t *testing.T) {
+	cases := []struct {
+		Resp      *ecs.DescribeTaskDefinitionOutput
+		Container string
+		Expected  string
+	}{
+		{
+			Resp: &ecs.DescribeTaskDefinitionOutput{
+				TaskDefinition: &ecs.TaskDefinition{
+					ContainerDefinitions: []*ecs.ContainerDefinition{
+						&ecs.ContainerDefinition{
+							Name:  aws.String("nginx"),
+							Image: aws.String("111222333444.dkr.ecr.us-west-1.amazonaws.com/nginx:1.15"),
+						},
+						&ecs.ContainerDefinition{
+							Name:  aws.String("app"),
+							Image: aws.String("111222333444.dkr.ecr.us-west-1.amazonaws.com/app:ea13366"),
+						},
+					},
+				},
+			},
+			Container: "app",
+			Expected:  "ea13366",
+		},
+		{
+			Resp: &ecs.DescribeTaskDefinitionOutput{
+				TaskDefinition: &ecs.TaskDefinition{
+					ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+						Name:  aws.String("app"),
+						Image: aws.String("localhost:5000/app:ea13366"),
+					}},
+				},
+			},
+			Container: "",
+			Expected:  "ea13366",
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: &mockedDescribeTaskDefinition{Resp: c.Resp},
+			ECR: mockedECRClient{},
+		}
+
+		commit, err := ufo.GetLastDeployedCommitForContainer("test-taskdefinition", c.Container)
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error %v", i, err)
+		}
+
+		if a, e := commit, c.Expected; a != e {
+			t.Errorf("%d, expected %v commit, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOPlanAll(t *testing.T) {
+	current := &ecs.TaskDefinition{
+		Cpu:               aws.String("256"),
+		Memory:            aws.String("512"),
+		TaskDefinitionArn: aws.String("arn:aws:ecs:us-east-1:111222333444:task-definition/api:12"),
+		ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+			Name:  aws.String("app"),
+			Image: aws.String("111222333444.dkr.ecr.us-west-1.amazonaws.com/app:cbd0d9c"),
+			Environment: []*ecs.KeyValuePair{&ecs.KeyValuePair{
+				Name:  aws.String("KEY1"),
+				Value: aws.String("VALUE1"),
+			}},
+		}},
+	}
+
+	cases := []struct {
+		Deployment *Deployment
+		Expected   []*FieldDiff
+	}{
+		{
+			Deployment: &Deployment{
+				DeployDetails: []*DeployDetail{&DeployDetail{TaskDefinition: current}},
+				BuildDetail:   BuildDetail{CommitHash: "8c018c8"},
+			},
+			Expected: []*FieldDiff{&FieldDiff{
+				Field: "container[app].image",
+				Old:   "111222333444.dkr.ecr.us-west-1.amazonaws.com/app:cbd0d9c",
+				New:   "111222333444.dkr.ecr.us-west-1.amazonaws.com/app:8c018c8",
+			}},
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedECSClient{},
+			ECR: mockedECRClient{},
+		}
+
+		plans, err := ufo.PlanAll(c.Deployment)
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error %v", i, err)
+		}
+
+		if a, e := len(plans[0].Diff), len(c.Expected); a != e {
+			t.Fatalf("%d, expected %d diffs, got %d", i, e, a)
+		}
+
+		for j, diff := range plans[0].Diff {
+			if a, e := *diff, *c.Expected[j]; a != e {
+				t.Errorf("%d, expected %v diff, got %v", i, e, a)
+			}
+		}
+
+		if a, e := *current.ContainerDefinitions[0].Image, "111222333444.dkr.ecr.us-west-1.amazonaws.com/app:cbd0d9c"; a != e {
+			t.Errorf("%d, expected current task definition image %v to be unchanged, got %v", i, e, a)
+		}
+	}
+}
+
+func TestDiffTaskDefinitions(t *testing.T) {
+	cases := []struct {
+		Old      *ecs.TaskDefinition
+		New      *ecs.TaskDefinition
+		Expected []*FieldDiff
+	}{
+		{
+			Old: &ecs.TaskDefinition{
+				Cpu:    aws.String("256"),
+				Memory: aws.String("512"),
+				ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+					Name: aws.String("app"),
+					Environment: []*ecs.KeyValuePair{
+						&ecs.KeyValuePair{Name: aws.String("KEY1"), Value: aws.String("VALUE1")},
+						&ecs.KeyValuePair{Name: aws.String("KEY2"), Value: aws.String("VALUE2")},
+					},
+				}},
+			},
+			New: &ecs.TaskDefinition{
+				Cpu:    aws.String("512"),
+				Memory: aws.String("512"),
+				ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+					Name: aws.String("app"),
+					Environment: []*ecs.KeyValuePair{
+						&ecs.KeyValuePair{Name: aws.String("KEY1"), Value: aws.String("VALUE3")},
+						&ecs.KeyValuePair{Name: aws.String("KEY3"), Value: aws.String("VALUE3")},
+					},
+				}},
+			},
+			Expected: []*FieldDiff{
+				&FieldDiff{Field: "cpu", Old: "256", New: "512"},
+				&FieldDiff{Field: "container[app].environment.KEY1", Old: "VALUE1", New: "VALUE3"},
+				&FieldDiff{Field: "container[app].environment.KEY2", Old: "VALUE2", New: ""},
+				&FieldDiff{Field: "container[app].environment.KEY3", Old: "", New: "VALUE3"},
+			},
+		},
+	}
+
+	for i, c := range cases {
+		diffs := DiffTaskDefinitions(c.Old, c.New)
+
+		if a, e := len(diffs), len(c.Expected); a != e {
+			t.Fatalf("%d, expected %d diffs, got %d", i, e, a)
+		}
+
+		for j, diff := range diffs {
+			if a, e := *diff, *c.Expected[j]; a != e {
+				t.Errorf("%d, expected %v diff, got %v", i, e, a)
+			}
+		}
+	}
+}
+
+func TestUFOAwaitServicesRunningCanceled(t *testing.T) {
+	ufo := UFO{
+		ECS: &mockedDescribeServices{Resp: &ecs.DescribeServicesOutput{
+			Services: []*ecs.Service{{
+				DesiredCount: aws.Int64(2),
+				Deployments: []*ecs.Deployment{{
+					TaskDefinition: aws.String("taskdefarn:2"),
+					DesiredCount:   aws.Int64(2),
+					RunningCount:   aws.Int64(1),
+					Status:         aws.String("PRIMARY"),
+				}},
+			}},
+		}},
+		ECR: mockedECRClient{},
+	}
+
+	details := []*DeployDetail{}
+	for i := 0; i < 2; i++ {
+		details = append(details, &DeployDetail{
+			Cluster:        &ecs.Cluster{},
+			Service:        &ecs.Service{ServiceArn: aws.String("servicearn")},
+			TaskDefinition: &ecs.TaskDefinition{TaskDefinitionArn: aws.String("taskdefarn:2")},
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneCh := ufo.AwaitServicesRunningWithContext(ctx, &Deployment{DeployDetails: details})
+
+	cancel()
+
+	select {
+	case d, ok := <-doneCh:
+		if ok {
+			t.Errorf("expected no service to be done, got %v", d)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the channel to be closed after the context was canceled")
+	}
+}
+
+func TestUFORevertAll(t *testing.T) {
+	cases := []struct {
+		UpdateServiceError error
+		Expected           string
+		ExpectedStatus     string
+	}{
+		{
+			UpdateServiceError: nil,
+			Expected:           "taskdefarn:1",
+			ExpectedStatus:     ResultSucceeded,
+		},
+		{
+			UpdateServiceError: errors.New("test-error"),
+			Expected:           "taskdefarn:2",
+			ExpectedStatus:     ResultFailed,
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedDeploy{
+				UpdateServiceResp:  &ecs.UpdateServiceOutput{},
+				UpdateServiceError: c.UpdateServiceError,
+			},
+			ECR: mockedECRClient{},
+		}
+
+		deployment := &Deployment{
+			DeployDetails: []*DeployDetail{
+				&DeployDetail{
+					Cluster:                &ecs.Cluster{},
+					Service:                &ecs.Service{},
+					TaskDefinition:         &ecs.TaskDefinition{TaskDefinitionArn: aws.String("taskdefarn:2")},
+					PreviousTaskDefinition: &ecs.TaskDefinition{TaskDefinitionArn: aws.String("taskdefarn:1")},
+				},
+				&DeployDetail{
+					Cluster:        &ecs.Cluster{},
+					Service:        &ecs.Service{},
+					TaskDefinition: &ecs.TaskDefinition{TaskDefinitionArn: aws.String("taskdefarn:5")},
+				},
+			},
+		}
+
+		results := ufo.RevertAll(deployment)
+
+		if a, e := len(results), 2; a != e {
+			t.Fatalf("%d, expected %d results, got %d", i, e, a)
+		}
+
+		if a, e := results[0].Err != nil, c.UpdateServiceError != nil; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, c.UpdateServiceError, results[0].Err)
+		}
+
+		if a, e := results[0].Status, c.ExpectedStatus; a != e {
+			t.Errorf("%d, expected %v status, got %v", i, e, a)
+		}
+
+		if a, e := results[1].Status, ResultSkipped; a != e {
+			t.Errorf("%d, expected %v status for a service without a previous task definition, got %v", i, e, a)
+		}
+
+		if a, e := *deployment.DeployDetails[0].TaskDefinition.TaskDefinitionArn, c.Expected; a != e {
+			t.Errorf("%d, expected %v task definition, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOGetTaskExitCode(t *testing.T) {
+	cases := []struct {
+		Resp     *ecs.DescribeTasksOutput
+		Expected int64
+	}{
+		{
+			Resp: &ecs.DescribeTasksOutput{
+				Tasks: []*ecs.Task{&ecs.Task{
+					Containers: []*ecs.Container{
+						&ecs.Container{Name: aws.String("log"), ExitCode: aws.Int64(137)},
+						&ecs.Container{Name: aws.String("app"), ExitCode: aws.Int64(0)},
+					},
+				}},
+			},
+			Expected: 0,
+		},
+		{
+			Resp: &ecs.DescribeTasksOutput{
+				Tasks: []*ecs.Task{&ecs.Task{
+					Containers: []*ecs.Container{&ecs.Container{Name: aws.String("app"), ExitCode: aws.Int64(1)}},
+				}},
+			},
+			Expected: 1,
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: &mockedDescribeTasks{Resp: c.Resp},
+			ECR: mockedECRClient{},
+		}
+
+		exitCode, err := ufo.GetTaskExitCode(&ecs.Cluster{}, aws.String("taskarn"), "app")
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error %v", i, err)
+		}
+
+		if a, e := exitCode, c.Expected; a != e {
+			t.Errorf("%d, expected %v exit code, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOGetTaskExitCodeError(t *testing.T) {
+	cases := []struct {
+		Resp     *ecs.DescribeTasksOutput
+		Expected error
+	}{
+		{
+			Resp: &ecs.DescribeTasksOutput{
+				Tasks: []*ecs.Task{&ecs.Task{
+					StoppedReason: aws.String("CannotPullContainerError"),
+					Containers:    []*ecs.Container{&ecs.Container{Name: aws.String("app")}},
+				}},
+			},
+			Expected: errors.Errorf("%s: %s", errTaskExitCodeUnknown, "CannotPullContainerError"),
+		},
+		{
+			Resp:     &ecs.DescribeTasksOutput{Tasks: []*ecs.Task{}},
+			Expected: errors.New(errTaskNotFound),
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: &mockedDescribeTasks{Resp: c.Resp},
+			ECR: mockedECRClient{},
+		}
+
+		_, err := ufo.GetTaskExitCode(&ecs.Cluster{}, aws.String("taskarn"), "app")
+
+		if a, e := err, c.Expected; a == nil || a.Error() != e.Error() {
+			t.Errorf("%d, expected %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFORegisterAll(t *testing.T) {
+	cases := []struct {
+		RegisterTaskDefResp  *ecs.RegisterTaskDefinitionOutput
+		RegisterTaskDefError error
+		Expected             string
+		ExpectedEvent        string
+	}{
+		{
+			RegisterTaskDefResp: &ecs.RegisterTaskDefinitionOutput{
+				TaskDefinition: &ecs.TaskDefinition{TaskDefinitionArn: aws.String("taskdefarn:2")},
+			},
+			Expected:      "taskdefarn:2",
+			ExpectedEvent: EventTaskDefinitionRegistered,
+		},
+		{
+			RegisterTaskDefError: errors.New("test-error"),
+			Expected:             "taskdefarn:1",
+			ExpectedEvent:        EventFailed,
+		},
+	}
+
+	for i, c := range cases {
+		current := &ecs.TaskDefinition{
+			TaskDefinitionArn: aws.String("taskdefarn:1"),
+			ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+				Name:  aws.String("app"),
+				Image: aws.String("111222333444.dkr.ecr.us-west-1.amazonaws.com/app:cbd0d9c"),
+			}},
+		}
+
+		reporter := &mockedReporter{}
+
+		ufo := UFO{
+			ECS: mockedDeploy{
+				DescribeTaskDefResp:  &ecs.DescribeTaskDefinitionOutput{TaskDefinition: current},
+				RegisterTaskDefResp:  c.RegisterTaskDefResp,
+				RegisterTaskDefError: c.RegisterTaskDefError,
+			},
+			ECR:      mockedECRClient{},
+			Reporter: reporter,
+		}
+
+		detail := &DeployDetail{
+			Cluster:        &ecs.Cluster{},
+			Service:        &ecs.Service{},
+			TaskDefinition: current,
+		}
+
+		results := ufo.RegisterAll(&Deployment{
+			DeployDetails: []*DeployDetail{detail},
+			BuildDetail:   BuildDetail{CommitHash: "8c018c8"},
+		})
+
+		if a, e := results.Err() != nil, c.RegisterTaskDefError != nil; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, c.RegisterTaskDefError, results.Err())
+		}
+
+		if a, e := *detail.TaskDefinition.TaskDefinitionArn, c.Expected; a != e {
+			t.Errorf("%d, expected %v task definition, got %v", i, e, a)
+		}
+
+		if len(reporter.Events) != 1 {
+			t.Fatalf("%d, expected 1 event, got %d", i, len(reporter.Events))
+		}
+
+		if a, e := reporter.Events[0].Type, c.ExpectedEvent; a != e {
+			t.Errorf("%d, expected %v event, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOTaskDefinitionHistory(t *testing.T) {
+	arn := "arn:aws:ecs:us-east-1:111222333444:task-definition/"
+	cases := []struct {
+		ListTaskDefsResp     *ecs.ListTaskDefinitionsOutput
+		DescribeTaskDefResps map[string]*ecs.DescribeTaskDefinitionOutput
+		Limit                int
+		Expected             []*Operation
+		ExpectedRollbacks    []*Operation
+	}{
+		{
+			ListTaskDefsResp: &ecs.ListTaskDefinitionsOutput{
+				TaskDefinitionArns: aws.StringSlice([]string{arn + "api:3", arn + "api-worker:9", arn + "api:2", arn + "api:1"}),
+			},
+			DescribeTaskDefResps: map[string]*ecs.DescribeTaskDefinitionOutput{
+				arn + "api:3": &ecs.DescribeTaskDefinitionOutput{
+					TaskDefinition: &ecs.TaskDefinition{Revision: aws.Int64(3)},
+					Tags: append((&Operation{
+						Type:     OperationDeploy,
+						Deployer: "dev@fuzzproductions.com",
+					}).Tags(), (&Operation{
+						Type:     OperationRollback,
+						Deployer: "ops@fuzzproductions.com",
+						Source:   "api:4",
+					}).RollbackTags()...),
+				},
+				arn + "api:2": &ecs.DescribeTaskDefinitionOutput{
+					TaskDefinition: &ecs.TaskDefinition{Revision: aws.Int64(2)},
+				},
+			},
+			Limit: 2,
+			Expected: []*Operation{
+				&Operation{
+					Type:     OperationDeploy,
+					Deployer: "dev@fuzzproductions.com",
+				},
+				nil,
+			},
+			ExpectedRollbacks: []*Operation{
+				&Operation{
+					Type:     OperationRollback,
+					Deployer: "ops@fuzzproductions.com",
+					Source:   "api:4",
+				},
+				nil,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedHistory{
+				ListTaskDefsResp:     c.ListTaskDefsResp,
+				DescribeTaskDefResps: c.DescribeTaskDefResps,
+			},
+			ECR: mockedECRClient{},
+		}
+
+		revisions, err := ufo.TaskDefinitionHistory("api", c.Limit)
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error %v", i, err)
+		}
+
+		if a, e := len(revisions), len(c.Expected); a != e {
+			t.Fatalf("%d, expected %d revisions, got %d", i, e, a)
+		}
+
+		for j, revision := range revisions {
+			if a, e := revision.Operation, c.Expected[j]; !reflect.DeepEqual(a, e) {
+				t.Errorf("%d, expected %v operation, got %v", i, e, a)
+			}
+
+			if a, e := revision.Rollback, c.ExpectedRollbacks[j]; !reflect.DeepEqual(a, e) {
+				t.Errorf("%d, expected %v rollback, got %v", i, e, a)
+			}
+		}
+	}
+}
+
+func TestUFORollbackAll(t *testing.T) {
+	arn := "arn:aws:ecs:us-east-1:111222333444:task-definition/"
+
+	cases := []struct {
+		Revision int
+		Expected string
+	}{
+		{Revision: 0, Expected: "api:5"},
+		{Revision: 3, Expected: "api:3"},
+	}
+
+	for i, c := range cases {
+		ecsClient := &mockedRollback{}
+		ufo := UFO{
+			ECS: ecsClient,
+			ECR: mockedECRClient{},
+		}
+
+		current := &ecs.TaskDefinition{TaskDefinitionArn: aws.String(arn + "api:6")}
+		detail := &DeployDetail{
+			Cluster:        &ecs.Cluster{ClusterName: aws.String("test-cluster")},
+			Service:        &ecs.Service{ServiceName: aws.String("api")},
+			TaskDefinition: current,
+		}
+
+		deployment := &Deployment{DeployDetails: []*DeployDetail{detail}}
+		deployment.SetOperation(&Operation{Type: OperationRollback, Deployer: "ops@fuzzproductions.com"})
+
+		results := ufo.RollbackAll(deployment, &DeployDetail{RevisionNumber: c.Revision})
+
+		if err := results.Err(); err != nil {
+			t.Fatalf("%d, unexpected error %v", i, err)
+		}
+
+		if a, e := *current.TaskDefinitionArn, arn+"api:6"; a != e {
+			t.Errorf("%d, expected the current task definition to stay %v, got %v", i, e, a)
+		}
+
+		if a, e := ecsClient.updated, arn+c.Expected; a != e {
+			t.Errorf("%d, expected the service to run %v, got %v", i, e, a)
+		}
+
+		if a, e := ecsClient.tagged, arn+c.Expected; a != e {
+			t.Errorf("%d, expected %v to be tagged, got %v", i, e, a)
+		}
+
+		if a, e := rollbackFromTags(ecsClient.tags), (&Operation{Type: OperationRollback, Deployer: "ops@fuzzproductions.com", Source: "api:6"}); !reflect.DeepEqual(a, e) {
+			t.Errorf("%d, expected rollback %v, got %v", i, e, a)
+		}
+
+		if a, e := aws.StringValue(detail.TaskDefinition.TaskDefinitionArn), arn+c.Expected; a != e {
+			t.Errorf("%d, expected the detail to await %v, got %v", i, e, a)
+		}
+
+		if a, e := aws.StringValue(detail.PreviousTaskDefinition.TaskDefinitionArn), arn+"api:6"; a != e {
+			t.Errorf("%d, expected previous task definition %v, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFORollbackAllTagFailure(t *testing.T) {
+	arn := "arn:aws:ecs:us-east-1:111222333444:task-definition/"
+	ecsClient := &mockedRollback{tagErr: errors.New("AccessDeniedException")}
+	reporter := &mockedReporter{}
+	ufo := UFO{
+		ECS:      ecsClient,
+		ECR:      mockedECRClient{},
+		Reporter: reporter,
+	}
+
+	detail := &DeployDetail{
+		Cluster:        &ecs.Cluster{ClusterName: aws.String("test-cluster")},
+		Service:        &ecs.Service{ServiceName: aws.String("api")},
+		TaskDefinition: &ecs.TaskDefinition{TaskDefinitionArn: aws.String(arn + "api:6")},
+	}
+
+	deployment := &Deployment{DeployDetails: []*DeployDetail{detail}}
+	deployment.SetOperation(&Operation{Type: OperationRollback, Deployer: "ops@fuzzproductions.com"})
+
+	results := ufo.RollbackAll(deployment, &DeployDetail{})
+
+	if err := results.Err(); err != nil {
+		t.Fatalf("expected the rollback to succeed when tagging fails, got %v", err)
+	}
+
+	if a, e := ecsClient.updated, arn+"api:5"; a != e {
+		t.Errorf("expected the service to run %v, got %v", e, a)
+	}
+
+	types := []string{}
+	for _, event := range reporter.Events {
+		types = append(types, event.Type)
+	}
+
+	if a, e := types, []string{EventWarning, EventServiceRolledBack}; !reflect.DeepEqual(a, e) {
+		t.Errorf("expected events %v, got %v", e, a)
+	}
+
+	if a, e := reporter.Events[0].Error, errCouldNotTagTaskDefinition+": AccessDeniedException"; a != e {
+		t.Errorf("expected warning %q, got %q", e, a)
+	}
+}
+
+func TestTagValue(t *testing.T) {
+	cases := []struct {
+		Value    string
+		Expected string
+	}{
+		{Value: "dev@fuzzproductions.com", Expected: "dev@fuzzproductions.com"},
+		{Value: "Jane Doe", Expected: "Jane Doe"},
+		{Value: "jane+ufo@fuzz-productions.com", Expected: "jane+ufo@fuzz-productions.com"},
+		{Value: "<jane>,doe!", Expected: "_jane__doe_"},
+		{Value: "josé", Expected: "josé"},
+		{Value: strings.Repeat("a", 300), Expected: strings.Repeat("a", 256)},
+	}
+
+	for i, c := range cases {
+		if a, e := tagValue(c.Value), c.Expected; a != e {
+			t.Errorf("%d, expected %q, got %q", i, e, a)
+		}
+	}
+}
+
+func TestUFOAcquireLock(t *testing.T) {
+	lockSettleTime = 0
+
+	cases := []struct {
+		Tags     map[string]string
+		Rival    map[string]string
+		Expected string
+		Error    bool
+	}{
 		{
-			Resp: &ecs.RunTaskOutput{
-				Tasks: []*ecs.Task{&ecs.Task{
-					ClusterArn:        aws.String("clusterarn"),
-					TaskDefinitionArn: aws.String("taskdefarn"),
-					Overrides: &ecs.TaskOverride{
-						ContainerOverrides: []*ecs.ContainerOverride{
-							&ecs.ContainerOverride{
-								Command: aws.StringSlice([]string{"echo", "this"}),
-								Name:    aws.String("task"),
-							},
-						},
-					},
-				}},
+			Tags:     map[string]string{},
+			Expected: "new",
+		},
+		{
+			Tags: map[string]string{
+				tagLockID:      "other",
+				tagLockHolder:  "dev@fuzzproductions.com",
+				tagLockExpires: time.Now().Add(time.Hour).Format(time.RFC3339),
 			},
-			Expected: &ecs.RunTaskOutput{
-				Tasks: []*ecs.Task{&ecs.Task{
-					ClusterArn:        aws.String("clusterarn"),
-					TaskDefinitionArn: aws.String("taskdefarn"),
-					Overrides: &ecs.TaskOverride{
-						ContainerOverrides: []*ecs.ContainerOverride{
-							&ecs.ContainerOverride{
-								Command: aws.StringSlice([]string{"echo", "this"}),
-								Name:    aws.String("task"),
-							},
-						},
-					},
-				}},
+			Expected: "other",
+			Error:    true,
+		},
+		{
+			Tags: map[string]string{
+				tagLockID:      "other",
+				tagLockHolder:  "dev@fuzzproductions.com",
+				tagLockExpires: time.Now().Add(-time.Hour).Format(time.RFC3339),
 			},
+			Expected: "new",
+		},
+		{
+			Tags: map[string]string{},
+			Rival: map[string]string{
+				tagLockID:      "rival",
+				tagLockHolder:  "ci@fuzzproductions.com",
+				tagLockExpires: time.Now().Add(time.Hour).Format(time.RFC3339),
+			},
+			Expected: "rival",
+			Error:    true,
 		},
 	}
 
 	for i, c := range cases {
 		ufo := UFO{
-			ECS: mockedRunTask{Resp: c.Resp},
+			ECS: mockedLock{Tags: c.Tags, Rival: c.Rival},
 			ECR: mockedECRClient{},
 		}
+		cluster := &ecs.Cluster{ClusterArn: aws.String("arn:aws:ecs:us-east-1:111222333444:cluster/dev")}
+		lock := NewLock("me@fuzzproductions.com", "abc1234", time.Hour)
+		lock.ID = "new"
 
-		ranTasks, err := ufo.RunTask(
-			&ecs.Cluster{ClusterName: aws.String("test-cluster")},
-			&ecs.TaskDefinition{
-				TaskDefinitionArn: aws.String("taskdefarn"),
-				ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
-					Name: aws.String("test-container"),
-				}},
+		err := ufo.AcquireLock(cluster, lock)
+
+		if a, e := err != nil, c.Error; a != e {
+			t.Errorf("%d, expected error %v, got %v", i, e, err)
+		}
+
+		if a, e := c.Tags[tagLockID], c.Expected; a != e {
+			t.Errorf("%d, expected lock %s, got %s", i, e, a)
+		}
+	}
+}
+
+func TestUFOReleaseLock(t *testing.T) {
+	cases := []struct {
+		Tags     map[string]string
+		Expected int
+	}{
+		{
+			Tags: map[string]string{
+				tagLockID:     "new",
+				tagLockHolder: "me@fuzzproductions.com",
+				"team":        "api",
 			},
-			"echo this",
-		)
+			Expected: 1,
+		},
+		{
+			Tags: map[string]string{
+				tagLockID:     "other",
+				tagLockHolder: "dev@fuzzproductions.com",
+			},
+			Expected: 2,
+		},
+	}
+
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: mockedLock{Tags: c.Tags},
+			ECR: mockedECRClient{},
+		}
+		cluster := &ecs.Cluster{ClusterArn: aws.String("arn:aws:ecs:us-east-1:111222333444:cluster/dev")}
+
+		err := ufo.ReleaseLock(cluster, &Lock{ID: "new"})
 
 		if err != nil {
-			t.Fatalf("%d, unexpected error", err)
+			t.Fatalf("%d, unexpected error %v", i, err)
 		}
 
-		for j, task := range ranTasks.Tasks {
-			if a, e := *task.ClusterArn, *c.Expected.Tasks[j].ClusterArn; a != e {
-				t.Errorf("%d, expected %v cluster arn, got %v", i, e, a)
-			}
+		if a, e := len(c.Tags), c.Expected; a != e {
+			t.Errorf("%d, expected %d tags, got %d", i, e, a)
+		}
+	}
+}
 
-			if a, e := *task.TaskDefinitionArn, *c.Expected.Tasks[j].TaskDefinitionArn; a != e {
-				t.Errorf("%d, expected %v task definition arn, got %v", i, e, a)
-			}
+func TestUFODeployAll(t *testing.T) {
+	cases := []struct {
+		RegisterTaskDefError error
+		UpdateServiceError   error
+		ExpectedStatus       string
+	}{
+		{
+			ExpectedStatus: ResultSucceeded,
+		},
+		{
+			RegisterTaskDefError: errors.New("test-error"),
+			ExpectedStatus:       ResultFailed,
+		},
+		{
+			UpdateServiceError: errors.New("test-error"),
+			ExpectedStatus:     ResultFailed,
+		},
+	}
 
-			actualOverride := task.Overrides.ContainerOverrides[0]
-			expectedOverride := c.Expected.Tasks[j].Overrides.ContainerOverrides[0]
+	for i, c := range cases {
+		current := &ecs.TaskDefinition{
+			TaskDefinitionArn: aws.String("taskdefarn:1"),
+			ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
+				Name:  aws.String("app"),
+				Image: aws.String("111222333444.dkr.ecr.us-west-1.amazonaws.com/app:cbd0d9c"),
+			}},
+		}
 
-			if a, e := *actualOverride.Name, *expectedOverride.Name; a != e {
-				t.Errorf("%d, expected %v name, got %v", i, e, a)
-			}
+		ufo := UFO{
+			ECS: mockedDeploy{
+				DescribeTaskDefResp: &ecs.DescribeTaskDefinitionOutput{TaskDefinition: current},
+				RegisterTaskDefResp: &ecs.RegisterTaskDefinitionOutput{
+					TaskDefinition: &ecs.TaskDefinition{TaskDefinitionArn: aws.String("taskdefarn:2")},
+				},
+				RegisterTaskDefError: c.RegisterTaskDefError,
+				UpdateServiceResp:    &ecs.UpdateServiceOutput{},
+				UpdateServiceError:   c.UpdateServiceError,
+			},
+			ECR: mockedECRClient{},
+		}
 
-			actualOverrideCommand := strings.Join(aws.StringValueSlice(actualOverride.Command), " ")
-			expectedOverrideCommand := strings.Join(aws.StringValueSlice(expectedOverride.Command), " ")
+		deployment := &Deployment{BuildDetail: BuildDetail{CommitHash: "8c018c8"}}
 
-			if a, e := actualOverrideCommand, expectedOverrideCommand; a != e {
-				t.Errorf("%d, expected %v command override, got %v", i, e, a)
+		for j := 0; j < 3; j++ {
+			deployment.DeployDetails = append(deployment.DeployDetails, &DeployDetail{
+				Cluster:        &ecs.Cluster{},
+				Service:        &ecs.Service{},
+				TaskDefinition: current,
+			})
+		}
+
+		results := ufo.DeployAll(deployment)
+
+		if a, e := len(results), len(deployment.DeployDetails); a != e {
+			t.Fatalf("%d, expected %d results, got %d", i, e, a)
+		}
+
+		for j, result := range results {
+			if a, e := result.Detail, deployment.DeployDetails[j]; a != e {
+				t.Errorf("%d, expected result %d for detail %d", i, j, j)
+			}
+
+			if a, e := result.Status, c.ExpectedStatus; a != e {
+				t.Errorf("%d, expected %v status, got %v", i, e, a)
 			}
 		}
+
+		if a, e := len(results.Succeeded()) == len(results), c.ExpectedStatus == ResultSucceeded; a != e {
+			t.Errorf("%d, expected all services to succeed %v, got %v", i, e, a)
+		}
 	}
 }
 
-func TestUFORunTaskError(t *testing.T) {
+func TestUFOGetServiceState(t *testing.T) {
+	primary := func(taskDef string, rolloutState string) *ecs.Deployment {
+		return &ecs.Deployment{
+			Status:         aws.String("PRIMARY"),
+			TaskDefinition: aws.String(taskDef),
+			RolloutState:   aws.String(rolloutState),
+		}
+	}
+
 	cases := []struct {
-		Error    error
-		Expected error
+		Deployments        []*ecs.Deployment
+		PreviousTaskDef    *ecs.TaskDefinition
+		Expected           string
+		ExpectedTaskDefRev string
 	}{
 		{
-			Error:    errors.New("test-error"),
-			Expected: errors.Wrap(errors.New("test-error"), errCouldNotRunTask),
+			Deployments:        []*ecs.Deployment{primary("arn:aws:ecs:task-definition/api:1", ecs.DeploymentRolloutStateCompleted)},
+			Expected:           StateNotUpdated,
+			ExpectedTaskDefRev: "api:1",
+		},
+		{
+			Deployments:        []*ecs.Deployment{primary("arn:aws:ecs:task-definition/api:1", ecs.DeploymentRolloutStateCompleted)},
+			PreviousTaskDef:    &ecs.TaskDefinition{TaskDefinitionArn: aws.String("arn:aws:ecs:task-definition/api:1")},
+			Expected:           StateNotUpdated,
+			ExpectedTaskDefRev: "api:1",
+		},
+		{
+			Deployments: []*ecs.Deployment{
+				primary("arn:aws:ecs:task-definition/api:2", ecs.DeploymentRolloutStateInProgress),
+				&ecs.Deployment{Status: aws.String("ACTIVE"), TaskDefinition: aws.String("arn:aws:ecs:task-definition/api:1")},
+			},
+			PreviousTaskDef:    &ecs.TaskDefinition{TaskDefinitionArn: aws.String("arn:aws:ecs:task-definition/api:1")},
+			Expected:           StateRollingOut,
+			ExpectedTaskDefRev: "api:2",
+		},
+		{
+			Deployments:        []*ecs.Deployment{primary("arn:aws:ecs:task-definition/api:2", ecs.DeploymentRolloutStateCompleted)},
+			PreviousTaskDef:    &ecs.TaskDefinition{TaskDefinitionArn: aws.String("arn:aws:ecs:task-definition/api:1")},
+			Expected:           StateUpdated,
+			ExpectedTaskDefRev: "api:2",
 		},
 	}
 
 	for i, c := range cases {
 		ufo := UFO{
-			ECS: mockedRunTask{Resp: nil, Error: c.Error},
+			ECS: &mockedDescribeServices{Resp: &ecs.DescribeServicesOutput{
+				Services: []*ecs.Service{&ecs.Service{
+					TaskDefinition: c.Deployments[0].TaskDefinition,
+					Deployments:    c.Deployments,
+				}},
+			}},
 			ECR: mockedECRClient{},
 		}
 
-		_, err := ufo.RunTask(
-			&ecs.Cluster{ClusterName: aws.String("test-cluster")},
-			&ecs.TaskDefinition{
-				TaskDefinitionArn: aws.String("taskdefarn"),
-				ContainerDefinitions: []*ecs.ContainerDefinition{&ecs.ContainerDefinition{
-					Name: aws.String("test-container"),
-				}},
+		state, err := ufo.GetServiceState(&DeployDetail{
+			Cluster:                &ecs.Cluster{},
+			Service:                &ecs.Service{ServiceArn: aws.String("api")},
+			TaskDefinition:         &ecs.TaskDefinition{TaskDefinitionArn: aws.String("arn:aws:ecs:task-definition/api:2")},
+			PreviousTaskDefinition: c.PreviousTaskDef,
+		})
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error %v", i, err)
+		}
+
+		if a, e := state.State, c.Expected; a != e {
+			t.Errorf("%d, expected %v state, got %v", i, e, a)
+		}
+
+		if a, e := state.TaskDefinition, c.ExpectedTaskDefRev; a != e {
+			t.Errorf("%d, expected %v task definition, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFORegisterAllCanceled(t *testing.T) {
+	ufo := UFO{
+		ECS: mockedDeploy{},
+		ECR: mockedECRClient{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := ufo.RegisterAllWithContext(ctx, &Deployment{
+		DeployDetails: []*DeployDetail{&DeployDetail{}, &DeployDetail{}},
+	})
+
+	for i, result := range results {
+		if a, e := result.Status, ResultSkipped; a != e {
+			t.Errorf("%d, expected %v status, got %v", i, e, a)
+		}
+	}
+}
+
+func TestUFOGetServiceProgress(t *testing.T) {
+	deployment := func(status string, taskDef string, desired, running, pending int64, rolloutState string) *ecs.Deployment {
+		d := &ecs.Deployment{
+			Status:         aws.String(status),
+			TaskDefinition: aws.String(taskDef),
+			DesiredCount:   aws.Int64(desired),
+			RunningCount:   aws.Int64(running),
+			PendingCount:   aws.Int64(pending),
+		}
+
+		if rolloutState != "" {
+			d.RolloutState = aws.String(rolloutState)
+		}
+
+		return d
+	}
+
+	cases := []struct {
+		Deployments    []*ecs.Deployment
+		ExpectedStable bool
+		ExpectedFailed bool
+		Expected       ServiceProgress
+	}{
+		{
+			Deployments: []*ecs.Deployment{
+				deployment("PRIMARY", "taskdefarn:2", 3, 3, 0, ecs.DeploymentRolloutStateCompleted),
 			},
-			"error",
-		)
+			ExpectedStable: true,
+			Expected:       ServiceProgress{Desired: 3, Running: 3, Deployments: 1, Primary: true, RolloutState: ecs.DeploymentRolloutStateCompleted},
+		},
+		{
+			Deployments: []*ecs.Deployment{
+				deployment("PRIMARY", "taskdefarn:2", 3, 3, 0, ""),
+			},
+			ExpectedStable: true,
+			Expected:       ServiceProgress{Desired: 3, Running: 3, Deployments: 1, Primary: true},
+		},
+		{
+			Deployments: []*ecs.Deployment{
+				deployment("PRIMARY", "taskdefarn:2", 3, 3, 0, ecs.DeploymentRolloutStateInProgress),
+				deployment("ACTIVE", "taskdefarn:1", 3, 2, 0, ecs.DeploymentRolloutStateCompleted),
+			},
+			Expected: ServiceProgress{Desired: 3, Running: 3, Draining: 2, Deployments: 2, Primary: true, RolloutState: ecs.DeploymentRolloutStateInProgress},
+		},
+		{
+			Deployments: []*ecs.Deployment{
+				deployment("PRIMARY", "taskdefarn:2", 3, 1, 2, ecs.DeploymentRolloutStateInProgress),
+			},
+			Expected: ServiceProgress{Desired: 3, Running: 1, Pending: 2, Deployments: 1, Primary: true, RolloutState: ecs.DeploymentRolloutStateInProgress},
+		},
+		{
+			Deployments: []*ecs.Deployment{
+				deployment("PRIMARY", "taskdefarn:1", 3, 3, 0, ecs.DeploymentRolloutStateCompleted),
+				deployment("ACTIVE", "taskdefarn:2", 0, 0, 0, ecs.DeploymentRolloutStateFailed),
+			},
+			ExpectedFailed: true,
+			Expected:       ServiceProgress{Running: 0, Draining: 3, Deployments: 2, RolloutState: ecs.DeploymentRolloutStateFailed},
+		},
+	}
 
-		if a, e := err, c.Expected; a.Error() != e.Error() {
-			t.Errorf("%d, expected %v, got %v", i, e, a)
+	for i, c := range cases {
+		ufo := UFO{
+			ECS: &mockedDescribeServices{Resp: &ecs.DescribeServicesOutput{
+				Services: []*ecs.Service{&ecs.Service{
+					DesiredCount: aws.Int64(3),
+					Deployments:  c.Deployments,
+				}},
+			}},
+			ECR: mockedECRClient{},
+		}
+
+		progress, err := ufo.GetServiceProgress(&DeployDetail{
+			Cluster:        &ecs.Cluster{},
+			Service:        &ecs.Service{ServiceArn: aws.String("api")},
+			TaskDefinition: &ecs.TaskDefinition{TaskDefinitionArn: aws.String("taskdefarn:2")},
+		})
+
+		if err != nil {
+			t.Fatalf("%d, unexpected error %v", i, err)
+		}
+
+		if a, e := *progress, c.Expected; a != e {
+			t.Errorf("%d, expected %+v progress, got %+v", i, e, a)
+		}
+
+		if a, e := progress.Stable(), c.ExpectedStable; a != e {
+			t.Errorf("%d, expected stable %v, got %v", i, e, a)
+		}
+
+		if a, e := progress.Failed(), c.ExpectedFailed; a != e {
+			t.Errorf("%d, expected failed %v, got %v", i, e, a)
 		}
 	}
 }